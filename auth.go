@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// errKeyRejected is returned when Meilisearch refuses the key
+var errKeyRejected = errors.New("the server rejected the key")
+
+func runAuthCommand(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "login":
+			return runAuthLoginCommand(args[1:])
+		case "status":
+			return runAuthStatusCommand(args[1:])
+		}
+	}
+	fmt.Fprintln(os.Stderr, "usage: goof [-profile name] auth login|status")
+	return exitError
+}
+
+// profileOrDefault is the name keys are stored under for config's profile
+func profileOrDefault(config Config) string {
+	if config.Profile == "" {
+		return "default"
+	}
+	return config.Profile
+}
+
+func runAuthLoginCommand(args []string) int {
+	fs := newFlagSet("auth login")
+	noVerify := fs.Bool("no-verify", false, "Store the key without checking it against the server")
+	if _, err := parseArgs(fs, args); err != nil {
+		return parseExitCode(err)
+	}
+
+	config := LoadConfig()
+	profile := profileOrDefault(config)
+	key, err := readKeyFromUser(profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goof auth login: %v\n", err)
+		return exitError
+	}
+	config.MeilisearchKey = Secret(key)
+	registerSecret(config.MeilisearchKey)
+
+	if !*noVerify {
+		if err := checkMeilisearchKey(config); err != nil {
+			fmt.Fprintf(os.Stderr, "goof auth login: %v\n", err)
+			return exitError
+		}
+	}
+
+	store, err := saveCredential(profile, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goof auth login: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("Stored the key for profile %s in the %s credential store\n", profile, store)
+
+	// A key named by the profile or environment still wins over a stored one
+	if config.KeySource != "" && config.KeySource != "keyring" && config.KeySource != "file" {
+		fmt.Fprintf(os.Stderr, "goof auth login: note: %s takes precedence over the stored key\n", config.KeySource)
+	}
+	return exitOK
+}
+
+// readKeyFromUser prompts for the key without echoing it, or reads the first
+// line of stdin when it isn't a terminal, e.g. `pass show meili | goof auth login`
+func readKeyFromUser(profile string) (string, error) {
+	var key string
+	if term.IsTerminal(os.Stdin.Fd()) {
+		fmt.Fprintf(os.Stderr, "Meilisearch key for profile %s: ", profile)
+		data, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read key: %w", err)
+		}
+		key = string(data)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read key from stdin: %w", err)
+		}
+		key = line
+	}
+
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", errors.New("no key given")
+	}
+	return key, nil
+}
+
+func runAuthStatusCommand(args []string) int {
+	fs := newFlagSet("auth status")
+	if _, err := parseArgs(fs, args); err != nil {
+		return parseExitCode(err)
+	}
+
+	config := LoadConfig()
+	fmt.Printf("Profile: %s\n", profileOrDefault(config))
+	fmt.Printf("Backend: %s\n", config.Backend)
+	if config.Backend != backendMeilisearch {
+		fmt.Println("No key needed")
+		return exitOK
+	}
+	fmt.Printf("URL:     %s\n", config.MeilisearchURL)
+
+	// Cached, so this is the same lookup LoadConfig did
+	_, _, keyErr := resolveKey(currentProfile())
+	switch {
+	case keyErr != nil:
+		fmt.Printf("Key:     %v\n", keyErr)
+		return exitError
+	case config.MeilisearchKey != "":
+		fmt.Printf("Key:     %s, from %s\n", config.MeilisearchKey, config.KeySource)
+	case config.KeySource != "":
+		fmt.Printf("Key:     none, %s is empty\n", config.KeySource)
+	default:
+		fmt.Println("Key:     none (run `goof auth login` to store one)")
+	}
+
+	if err := checkMeilisearchKey(config); err != nil {
+		fmt.Printf("Server:  %v\n", err)
+		return exitError
+	}
+	fmt.Println("Server:  key accepted")
+	return exitOK
+}
+
+// checkMeilisearchKey makes sure the server is up and accepts config's key
+// for searching its index
+func checkMeilisearchKey(config Config) error {
+	client := meilisearch.New(config.MeilisearchURL, meilisearch.WithAPIKey(config.MeilisearchKey.Reveal()))
+	if _, err := client.Health(); err != nil {
+		return fmt.Errorf("failed to reach %s: %w", config.MeilisearchURL, err)
+	}
+
+	_, err := client.Index(config.IndexName).Search("", &meilisearch.SearchRequest{Limit: 1})
+	var meiliErr *meilisearch.Error
+	if errors.As(err, &meiliErr) {
+		switch meiliErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return errKeyRejected
+		case http.StatusNotFound:
+			// The key works; the index just hasn't been created yet
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to search %s: %w", config.IndexName, err)
+	}
+	return nil
+}
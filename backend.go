@@ -1,20 +1,64 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/meilisearch/meilisearch-go"
 )
 
-func SearchErrorReports(filter Filter) ([]ErrorReport, error) {
-	config := LoadConfig()
-	logToFile("DEBUG: SearchErrorReports - Creating Meilisearch client with URL: %s, Key: '%s' (len=%d)\n",
-		config.MeilisearchURL, config.MeilisearchKey, len(config.MeilisearchKey))
+// meilisearchStore keeps reports in a Meilisearch index
+type meilisearchStore struct {
+	config Config
+}
+
+// Index settings Initialize applies. Order matters for searchable attributes:
+// earlier attributes rank higher, so the headline outweighs the rest of the
+// symptom.
+var (
+	indexSearchableAttributes = []string{
+		"headline",
+		"symptom",
+		"program",
+		"program_version",
+		"distro",
+		"distro_version",
+		"solution",
+	}
+	// For exact filtering (dates, resources, environment, and the team that
+	// tenant tokens are usually scoped to). The ID is filterable so that a
+	// tenant token, which can only search, can still look a report up.
+	indexFilterableAttributes = []string{
+		"id",
+		"date",
+		"resources",
+		"environment",
+		"fingerprint",
+		"extracted",
+		"program",
+		"team",
+	}
+)
+
+func (s meilisearchStore) client() meilisearch.ServiceManager {
+	slog.Debug("Creating Meilisearch client", "url", s.config.MeilisearchURL, "key", s.config.MeilisearchKey,
+		"key_len", len(s.config.MeilisearchKey), "index", s.config.IndexName)
+	return meilisearch.New(s.config.MeilisearchURL, meilisearch.WithAPIKey(s.config.MeilisearchKey.Reveal()))
+}
+
+func (s meilisearchStore) index() meilisearch.IndexManager {
+	return s.client().Index(s.config.IndexName)
+}
 
-	client := meilisearch.New(config.MeilisearchURL, meilisearch.WithAPIKey(config.MeilisearchKey))
-	index := client.Index(config.IndexName)
+func (s meilisearchStore) Search(filter Filter) ([]ErrorReport, error) {
+	index := s.index()
 
 	// Build search query for full-text search
 	var queryParts []string
@@ -28,7 +72,11 @@ func SearchErrorReports(filter Filter) ([]ErrorReport, error) {
 	if filter.Symptom != "" {
 		queryParts = append(queryParts, filter.Symptom)
 	}
-	if filter.Program != "" {
+	// Known programs are filtered on every alias instead of matched as text,
+	// so "gcc" also finds reports filed under "cc1plus" or "g++", and on the
+	// stored names that clean up to one of them
+	programAliases := programFilterAliases(filter.Program)
+	if filter.Program != "" && len(programAliases) == 0 {
 		queryParts = append(queryParts, filter.Program)
 	}
 	if filter.ProgramVersion != "" {
@@ -59,13 +107,46 @@ func SearchErrorReports(filter Filter) ([]ErrorReport, error) {
 	if len(filter.ResourcesAny) > 0 {
 		resourceFilters := make([]string, len(filter.ResourcesAny))
 		for i, resource := range filter.ResourcesAny {
-			resourceFilters[i] = fmt.Sprintf("resources = \"%s\"", resource)
+			resourceFilters[i] = fmt.Sprintf("resources = %s", quoteFilterValue(resource))
 		}
 		filters = append(filters, fmt.Sprintf("(%s)", strings.Join(resourceFilters, " OR ")))
 	}
+	if len(programAliases) > 0 {
+		names := programAliases
+		stored, err := storedProgramNames(index)
+		if err != nil {
+			slog.Debug("Couldn't list the stored program names", "err", err)
+		}
+		for _, name := range stored {
+			if !slices.Contains(names, name) && matchesProgramAliases(name, programAliases) {
+				names = append(names, name)
+			}
+		}
+		quoted := make([]string, len(names))
+		for i, name := range names {
+			quoted[i] = quoteFilterValue(name)
+		}
+		filters = append(filters, fmt.Sprintf("program IN [%s]", strings.Join(quoted, ", ")))
+	}
+	if filter.Fingerprint != "" {
+		filters = append(filters, fmt.Sprintf("fingerprint = %s", quoteFilterValue(filter.Fingerprint)))
+	}
+	if filter.Team != "" {
+		filters = append(filters, fmt.Sprintf("team = %s", quoteFilterValue(filter.Team)))
+	}
+	for _, key := range sortedKeys(filter.Extracted) {
+		filters = append(filters, fmt.Sprintf("extracted.%s = %s", key, quoteFilterValue(filter.Extracted[key])))
+	}
+	for _, key := range sortedKeys(filter.Environment) {
+		if err := validateEnvironmentKey(key); err != nil {
+			return nil, fmt.Errorf("failed to search: %w", err)
+		}
+		filters = append(filters, fmt.Sprintf("environment.%s = %s", key, quoteFilterValue(filter.Environment[key])))
+	}
 
 	searchRequest := &meilisearch.SearchRequest{
-		Limit: 100,
+		Limit:            100,
+		ShowRankingScore: true,
 	}
 
 	if len(filters) > 0 {
@@ -84,94 +165,223 @@ func SearchErrorReports(filter Filter) ([]ErrorReport, error) {
 			continue
 		}
 
-		report := ErrorReport{
-			ID:             getString(hitMap, "id"),
-			Symptom:        getString(hitMap, "symptom"),
-			Program:        getString(hitMap, "program"),
-			ProgramVersion: getString(hitMap, "program_version"),
-			Distro:         getString(hitMap, "distro"),
-			DistroVersion:  getString(hitMap, "distro_version"),
-			Solution:       getString(hitMap, "solution"),
-			Resources:      getStringArray(hitMap, "resources"),
-		}
-
-		// Convert Unix timestamp back to time.Time
-		if dateField, ok := hitMap["date"]; ok {
-			if dateFloat, ok := dateField.(float64); ok {
-				report.Date = time.Unix(int64(dateFloat), 0)
-			}
-		}
-
+		report := reportFromHit(hitMap)
+		report.Relevance, _ = hitMap["_rankingScore"].(float64)
 		reports = append(reports, report)
 	}
 
 	return reports, nil
 }
 
-func SaveErrorReport(report ErrorReport) error {
-	config := LoadConfig()
-	logToFile("DEBUG: SaveErrorReport - Creating Meilisearch client with URL: %s, Key: '%s' (len=%d)\n",
-		config.MeilisearchURL, config.MeilisearchKey, len(config.MeilisearchKey))
+func (s meilisearchStore) Get(id string) (ErrorReport, error) {
+	var document map[string]interface{}
+	if err := s.index().GetDocument(id, nil, &document); err != nil {
+		if isSearchOnlyError(err) {
+			return s.searchByID(id)
+		}
+		var meiliErr *meilisearch.Error
+		if errors.As(err, &meiliErr) && meiliErr.StatusCode == http.StatusNotFound {
+			return ErrorReport{}, fmt.Errorf("%w: %s", ErrReportNotFound, id)
+		}
+		return ErrorReport{}, fmt.Errorf("failed to get error report: %w", err)
+	}
 
-	logToFile("%+v\n", report)
+	return reportFromHit(document), nil
+}
 
-	client := meilisearch.New(config.MeilisearchURL, meilisearch.WithAPIKey(config.MeilisearchKey))
-	index := client.Index(config.IndexName)
+// storedProgramNames lists the distinct programs reports are filed under, so
+// that a program filter also finds reports saved before programs were
+// canonicalized, e.g. as "GCC" or "gcc-13". Meilisearch returns at most its
+// maxValuesPerFacet setting (100 by default) of them.
+func storedProgramNames(index meilisearch.IndexManager) ([]string, error) {
+	response, err := index.Search("", &meilisearch.SearchRequest{
+		Limit:  1,
+		Facets: []string{"program"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	distribution, _ := response.FacetDistribution.(map[string]interface{})
+	counts, _ := distribution["program"].(map[string]interface{})
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
 
-	// Generate unique ID based on timestamp and program
-	id := fmt.Sprintf("%d-%s", time.Now().UnixNano(), report.Program)
+// isSearchOnlyError reports whether err is Meilisearch refusing a documents
+// request, as it does for tenant tokens (see goof token), which may only search
+func isSearchOnlyError(err error) bool {
+	var meiliErr *meilisearch.Error
+	return errors.As(err, &meiliErr) &&
+		(meiliErr.StatusCode == http.StatusUnauthorized || meiliErr.StatusCode == http.StatusForbidden)
+}
 
-	// Create document with ID
-	document := map[string]interface{}{
-		"id":              id,
-		"symptom":         report.Symptom,
-		"date":            report.Date.Unix(), // Store as Unix timestamp for filtering
-		"program":         report.Program,
-		"program_version": report.ProgramVersion,
-		"distro":          report.Distro,
-		"distro_version":  report.DistroVersion,
-		"resources":       report.Resources,
-		"solution":        report.Solution,
+// searchByID gets a report with a search instead of the documents endpoint
+func (s meilisearchStore) searchByID(id string) (ErrorReport, error) {
+	response, err := s.index().Search("", &meilisearch.SearchRequest{
+		Filter: "id = " + quoteFilterValue(id),
+		Limit:  1,
+	})
+	if err != nil {
+		return ErrorReport{}, fmt.Errorf("failed to get error report: %w", err)
+	}
+	if len(response.Hits) == 0 {
+		return ErrorReport{}, fmt.Errorf("%w: %s", ErrReportNotFound, id)
 	}
+	hitMap, ok := response.Hits[0].(map[string]interface{})
+	if !ok {
+		return ErrorReport{}, fmt.Errorf("failed to get error report: unexpected search hit %T", response.Hits[0])
+	}
+	return reportFromHit(hitMap), nil
+}
 
-	_, err := index.AddDocuments([]map[string]interface{}{document})
-	if err != nil {
-		return fmt.Errorf("failed to save error report: %w", err)
+// All fetches every report in the index, a page at a time
+func (s meilisearchStore) All() ([]ErrorReport, error) {
+	index := s.index()
+
+	const pageSize = 500
+	var reports []ErrorReport
+	for offset := int64(0); ; offset += pageSize {
+		var page meilisearch.DocumentsResult
+		err := index.GetDocuments(&meilisearch.DocumentsQuery{Offset: offset, Limit: pageSize}, &page)
+		if err != nil && offset == 0 && isSearchOnlyError(err) {
+			return s.allBySearch()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list error reports: %w", err)
+		}
+		for _, document := range page.Results {
+			reports = append(reports, reportFromHit(document))
+		}
+		if offset+pageSize >= page.Total {
+			break
+		}
 	}
 
-	return nil
+	return reports, nil
 }
 
-func UpdateErrorReport(report ErrorReport, originalID string) error {
-	config := LoadConfig()
-	logToFile("DEBUG: UpdateErrorReport - Creating Meilisearch client with URL: %s, Key: '%s' (len=%d)\n",
-		config.MeilisearchURL, config.MeilisearchKey, len(config.MeilisearchKey))
+// allBySearch lists reports with searches instead of the documents endpoint.
+// Meilisearch stops a search at its maxTotalHits setting (1000 by default),
+// so with a tenant token that's as many reports as can be listed.
+func (s meilisearchStore) allBySearch() ([]ErrorReport, error) {
+	index := s.index()
 
-	logToFile("Updating report with ID: %s, %+v\n", originalID, report)
+	const pageSize = 500
+	var reports []ErrorReport
+	for offset := int64(0); ; offset += pageSize {
+		response, err := index.Search("", &meilisearch.SearchRequest{Offset: offset, Limit: pageSize})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list error reports: %w", err)
+		}
+		for _, hit := range response.Hits {
+			if hitMap, ok := hit.(map[string]interface{}); ok {
+				reports = append(reports, reportFromHit(hitMap))
+			}
+		}
+		if int64(len(response.Hits)) < pageSize {
+			break
+		}
+	}
 
-	client := meilisearch.New(config.MeilisearchURL, meilisearch.WithAPIKey(config.MeilisearchKey))
-	index := client.Index(config.IndexName)
+	return reports, nil
+}
+
+// Put adds a document, replacing any existing one with the same ID. It waits
+// for Meilisearch to index it, so the report can be read back right away and
+// a rejected document is reported rather than lost.
+func (s meilisearchStore) Put(document map[string]interface{}) error {
+	client := s.client()
+	info, err := client.Index(s.config.IndexName).AddDocuments([]map[string]interface{}{document})
+	if err != nil {
+		return err
+	}
+	return waitForTask(client, info)
+}
+
+// reportDocument converts a report into the document stored in Meilisearch
+func reportDocument(report ErrorReport, id string) map[string]interface{} {
+	environment := report.Environment
+	if environment == nil {
+		environment = map[string]string{}
+	}
+	_, diagnostics := ParseDiagnostics(report.Symptom)
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
 
-	// Create updated document with same ID
-	document := map[string]interface{}{
-		"id":              originalID,
+	return map[string]interface{}{
+		"id":              id,
+		"headline":        deriveHeadline(report.Symptom),
 		"symptom":         report.Symptom,
 		"date":            report.Date.Unix(), // Store as Unix timestamp for filtering
 		"program":         report.Program,
 		"program_version": report.ProgramVersion,
 		"distro":          report.Distro,
 		"distro_version":  report.DistroVersion,
+		"team":            report.Team,
+		"environment":     environment,
+		"fingerprint":     Fingerprint(report.Symptom),
+		"diagnostics":     diagnostics,
+		"traceback":       ParseTraceback(report.Symptom),
+		"extracted":       RecognizeErrors(report.Symptom),
 		"resources":       report.Resources,
 		"solution":        report.Solution,
 	}
+}
 
-	// Update the document (Meilisearch will replace the existing document with the same ID)
-	_, err := index.AddDocuments([]map[string]interface{}{document})
-	if err != nil {
-		return fmt.Errorf("failed to update error report: %w", err)
+// reportFromHit converts a Meilisearch document back into a report
+func reportFromHit(hitMap map[string]interface{}) ErrorReport {
+	report := ErrorReport{
+		ID:             getString(hitMap, "id"),
+		Symptom:        getString(hitMap, "symptom"),
+		Headline:       getString(hitMap, "headline"),
+		Program:        getString(hitMap, "program"),
+		ProgramVersion: getString(hitMap, "program_version"),
+		Distro:         getString(hitMap, "distro"),
+		DistroVersion:  getString(hitMap, "distro_version"),
+		Team:           getString(hitMap, "team"),
+		Environment:    getStringMap(hitMap, "environment"),
+		Fingerprint:    getString(hitMap, "fingerprint"),
+		Solution:       getString(hitMap, "solution"),
+		Resources:      getStringArray(hitMap, "resources"),
 	}
 
-	return nil
+	// Convert Unix timestamp back to time.Time
+	if dateField, ok := hitMap["date"]; ok {
+		if dateFloat, ok := dateField.(float64); ok {
+			report.Date = time.Unix(int64(dateFloat), 0)
+		}
+	}
+	decodeField(hitMap, "diagnostics", &report.Diagnostics)
+	decodeField(hitMap, "traceback", &report.Traceback)
+	decodeField(hitMap, "extracted", &report.Extracted)
+
+	return report
+}
+
+// quoteFilterValue quotes a string for use in a Meilisearch filter expression
+func quoteFilterValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+// decodeField decodes a nested document field into a typed value by
+// round-tripping it through JSON, leaving target untouched on failure
+func decodeField(m map[string]interface{}, key string, target interface{}) {
+	val, ok := m[key]
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, target)
 }
 
 func getString(m map[string]interface{}, key string) string {
@@ -198,57 +408,104 @@ func getStringArray(m map[string]interface{}, key string) []string {
 	return []string{}
 }
 
-func DeleteErrorReport(id string) error {
-	config := LoadConfig()
-	logToFile("DEBUG: DeleteErrorReport - Creating Meilisearch client with URL: %s, Key: '%s' (len=%d)\n",
-		config.MeilisearchURL, config.MeilisearchKey, len(config.MeilisearchKey))
-
-	logToFile("Deleting report with ID: %s\n", id)
-
-	client := meilisearch.New(config.MeilisearchURL, meilisearch.WithAPIKey(config.MeilisearchKey))
-	index := client.Index(config.IndexName)
+func getStringMap(m map[string]interface{}, key string) map[string]string {
+	result := map[string]string{}
+	if val, ok := m[key]; ok {
+		if obj, ok := val.(map[string]interface{}); ok {
+			for k, item := range obj {
+				if str, ok := item.(string); ok {
+					result[k] = str
+				}
+			}
+		}
+	}
+	return result
+}
 
+func (s meilisearchStore) Delete(id string) error {
 	// Delete the document from Meilisearch
-	_, err := index.DeleteDocument(id)
+	client := s.client()
+	info, err := client.Index(s.config.IndexName).DeleteDocument(id)
 	if err != nil {
 		return fmt.Errorf("failed to delete error report: %w", err)
 	}
+	if err := waitForTask(client, info); err != nil {
+		return fmt.Errorf("failed to delete error report: %w", err)
+	}
 
 	return nil
 }
 
-func InitializeIndexIfNeeded() error {
-	config := LoadConfig()
-	client := meilisearch.New(config.MeilisearchURL, meilisearch.WithAPIKey(config.MeilisearchKey))
-	index := client.Index(config.IndexName)
-
-	// Define searchable attributes for full-text search
-	searchableAttributes := []string{
-		"symptom",
-		"program",
-		"program_version",
-		"distro",
-		"distro_version",
-		"solution",
-	}
-
-	// Define filterable attributes for exact filtering (dates, resources)
-	filterableAttributes := []string{
-		"date",
-		"resources",
-	}
+func (s meilisearchStore) Initialize() error {
+	client := s.client()
+	index := client.Index(s.config.IndexName)
 
 	// Update searchable attributes
-	_, err := index.UpdateSearchableAttributes(&searchableAttributes)
+	task, err := index.UpdateSearchableAttributes(&indexSearchableAttributes)
 	if err != nil {
 		return fmt.Errorf("failed to update searchable attributes: %w", err)
 	}
+	if err := waitForTask(client, task); err != nil {
+		return fmt.Errorf("failed to update searchable attributes: %w", err)
+	}
 
 	// Update filterable attributes
-	_, err = index.UpdateFilterableAttributes(&filterableAttributes)
+	task, err = index.UpdateFilterableAttributes(&indexFilterableAttributes)
 	if err != nil {
 		return fmt.Errorf("failed to update filterable attributes: %w", err)
 	}
+	if err := waitForTask(client, task); err != nil {
+		return fmt.Errorf("failed to update filterable attributes: %w", err)
+	}
+
+	return nil
+}
+
+// NeedsInitialization reports whether the index is missing or its settings
+// differ from what Initialize applies
+func (s meilisearchStore) NeedsInitialization() (bool, error) {
+	client := s.client()
+	if _, err := client.GetIndex(s.config.IndexName); err != nil {
+		var meiliErr *meilisearch.Error
+		if errors.As(err, &meiliErr) && meiliErr.StatusCode == http.StatusNotFound {
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to check index: %w", err)
+	}
 
+	index := client.Index(s.config.IndexName)
+	searchable, err := index.GetSearchableAttributes()
+	if err != nil {
+		return false, fmt.Errorf("failed to check index settings: %w", err)
+	}
+	filterable, err := index.GetFilterableAttributes()
+	if err != nil {
+		return false, fmt.Errorf("failed to check index settings: %w", err)
+	}
+	return !slices.Equal(*searchable, indexSearchableAttributes) || len(missingFilterableAttributes(*filterable)) > 0, nil
+}
+
+// missingFilterableAttributes lists the attributes goof filters on that
+// aren't in filterable
+func missingFilterableAttributes(filterable []string) []string {
+	var missing []string
+	for _, attribute := range indexFilterableAttributes {
+		if !slices.Contains(filterable, attribute) {
+			missing = append(missing, attribute)
+		}
+	}
+	return missing
+}
+
+// waitForTask waits for Meilisearch to process an enqueued task, so settings
+// are in place by the time Initialize returns
+func waitForTask(client meilisearch.ServiceManager, info *meilisearch.TaskInfo) error {
+	task, err := client.WaitForTask(info.TaskUID, 100*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	if task.Status == meilisearch.TaskStatusFailed {
+		return errors.New(task.Error.Message)
+	}
 	return nil
 }
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Exit codes follow grep: 0 when something was found or done, 1 when nothing
+// matched, 2 when something went wrong
+const (
+	exitOK      = 0
+	exitNoMatch = 1
+	exitError   = 2
+)
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"search", "search [query... | -] [flags]", "Search error reports", runSearchCommand},
+		{"show", "show <id> [flags]", "Print a single error report", runShowCommand},
+		{"add", "add [flags]", "Save a new error report", runAddCommand},
+		{"edit", "edit <id> [flags]", "Change fields of an existing error report", runEditCommand},
+		{"delete", "delete <id>", "Delete an error report", runDeleteCommand},
+		{"run", "run [flags] -- <command>", "Run a command and look up its error if it fails", runRunCommand},
+		{"auth", "auth login|status", "Store the Meilisearch key, or check it against the server", runAuthCommand},
+		{"token", "token [flags]", "Mint a read-only tenant token for searching the index", runTokenCommand},
+		{"doctor", "doctor [-fix]", "Check the connection, key and index, and repair the index settings", runDoctorCommand},
+		{"keygen", "keygen [-o path]", "Create the key that encrypts solutions", runKeygenCommand},
+		{"serve", "serve [flags]", "Serve reports over a JSON REST API", runServeCommand},
+		{"help", "help", "Show this help", runHelpCommand},
+	}
+}
+
+// runCommand dispatches a non-interactive subcommand and returns its exit code
+func runCommand(args []string) int {
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "goof: unknown command %q\n\n", args[0])
+	printUsage(os.Stderr)
+	return exitError
+}
+
+func runHelpCommand(args []string) int {
+	printUsage(os.Stdout)
+	return exitOK
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: goof [global flags] [command]\n\n")
+	fmt.Fprintf(w, "Without a command goof starts the interactive UI.\n\n")
+	fmt.Fprintf(w, "Commands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-28s %s\n", cmd.usage, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nGlobal flags:\n")
+	flag.CommandLine.SetOutput(w)
+	flag.PrintDefaults()
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("goof "+name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// parseArgs parses flags that may be mixed with positional arguments, so that
+// `goof search "undefined reference" --program ld` works. Everything after a
+// literal "--" is treated as positional.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, rest = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	return append(positional, rest...), nil
+}
+
+// stringList is a flag that can be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// keyValueFlag collects repeated key=value flags into a map
+type keyValueFlag map[string]string
+
+func (kv keyValueFlag) String() string {
+	return formatEnvironment(kv, ",")
+}
+
+func (kv keyValueFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	if err := validateEnvironmentKey(key); err != nil {
+		return err
+	}
+	kv[key] = val
+	return nil
+}
+
+// reportFlags are the flags shared by add and edit for setting report fields
+type reportFlags struct {
+	symptom        string
+	symptomFile    string
+	program        string
+	programVersion string
+	distro         string
+	distroVersion  string
+	team           string
+	solution       string
+	solutionFile   string
+	resources      stringList
+	environment    keyValueFlag
+}
+
+func (f *reportFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.symptom, "symptom", "", "Symptom text")
+	fs.StringVar(&f.symptomFile, "symptom-file", "", "Read the symptom from a file (- for stdin)")
+	fs.StringVar(&f.program, "program", "", "Program that produced the error")
+	fs.StringVar(&f.programVersion, "program-version", "", "Program version")
+	fs.StringVar(&f.distro, "distro", "", "Distribution")
+	fs.StringVar(&f.distroVersion, "distro-version", "", "Distribution version")
+	fs.StringVar(&f.team, "team", "", "Team the report belongs to")
+	fs.StringVar(&f.solution, "solution", "", "Solution text")
+	fs.StringVar(&f.solutionFile, "solution-file", "", "Read the solution from a file (- for stdin)")
+	fs.Var(&f.resources, "resource", "Related resource, e.g. a URL (repeatable)")
+	f.environment = keyValueFlag{}
+	fs.Var(f.environment, "env", "Environment entry as key=value (repeatable)")
+}
+
+// apply copies the flags that were explicitly set onto the report
+func (f *reportFlags) apply(fs *flag.FlagSet, report *ErrorReport) error {
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		if err != nil {
+			return
+		}
+		switch fl.Name {
+		case "symptom":
+			report.Symptom = f.symptom
+		case "symptom-file":
+			report.Symptom, err = readTextFile(f.symptomFile)
+		case "program":
+			report.Program = f.program
+		case "program-version":
+			report.ProgramVersion = f.programVersion
+		case "distro":
+			report.Distro = f.distro
+		case "distro-version":
+			report.DistroVersion = f.distroVersion
+		case "team":
+			report.Team = f.team
+		case "solution":
+			report.Solution = f.solution
+		case "solution-file":
+			report.Solution, err = readTextFile(f.solutionFile)
+		case "resource":
+			report.Resources = f.resources
+		case "env":
+			if report.Environment == nil {
+				report.Environment = map[string]string{}
+			}
+			for key, value := range f.environment {
+				report.Environment[key] = value
+			}
+		}
+	})
+	return err
+}
+
+// readTextFile reads a whole file, or stdin when the path is "-"
+func readTextFile(path string) (string, error) {
+	if path == "-" {
+		return readPipedInput()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\n"), nil
+}
+
+func runSearchCommand(args []string) int {
+	fs := newFlagSet("search")
+	var filter Filter
+	var resources stringList
+	environment := keyValueFlag{}
+	var dateFrom, dateTo string
+	fs.StringVar(&filter.Symptom, "symptom", "", "Search by symptom")
+	fs.StringVar(&filter.Program, "program", "", "Search by program")
+	fs.StringVar(&filter.ProgramVersion, "program-version", "", "Search by program version")
+	fs.StringVar(&filter.Distro, "distro", "", "Search by distro")
+	fs.StringVar(&filter.DistroVersion, "distro-version", "", "Search by distro version")
+	fs.StringVar(&filter.Team, "team", "", "Only reports belonging to this team")
+	fs.StringVar(&filter.Solution, "solution", "", "Search by solution text")
+	fs.StringVar(&dateFrom, "from", "", "Only reports on or after this date (YYYY-MM-DD)")
+	fs.StringVar(&dateTo, "to", "", "Only reports on or before this date (YYYY-MM-DD)")
+	fs.Var(&resources, "resource", "Only reports with this resource (repeatable, any matches)")
+	fs.Var(environment, "env", "Only reports whose environment has key=value (repeatable)")
+	extracted := map[string]*string{
+		extractedPackages:  fs.String("package", "", "Only reports mentioning this package"),
+		extractedSymbols:   fs.String("symbol", "", "Only reports with this undefined or duplicate symbol"),
+		extractedHeaders:   fs.String("header", "", "Only reports with this missing header"),
+		extractedLibraries: fs.String("library", "", "Only reports with this missing library"),
+	}
+	preferEnv := fs.Bool("prefer-env", true, "Rank reports from a similar machine ahead of equally relevant ones")
+	fromStdin := fs.Bool("stdin", false, "Look up the error in the output on stdin (the same as a query of -)")
+	asJSON := fs.Bool("json", false, "Print results as JSON")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return parseExitCode(err)
+	}
+
+	if len(positional) == 1 && positional[0] == "-" {
+		*fromStdin = true
+		positional = nil
+	}
+	filter.Q = strings.Join(positional, " ")
+	var pipedSymptom string
+	if *fromStdin || (filter.Q == "" && stdinIsPiped()) {
+		// `make 2>&1 | goof search`: look up the error in the piped output
+		if pipedSymptom, err = readPipedInput(); err != nil {
+			fmt.Fprintf(os.Stderr, "goof search: %v\n", err)
+			return exitError
+		}
+	}
+	filter.ResourcesAny = resources
+	for field, value := range extracted {
+		if *value != "" {
+			if filter.Extracted == nil {
+				filter.Extracted = map[string]string{}
+			}
+			filter.Extracted[field] = *value
+		}
+	}
+	if len(environment) > 0 {
+		filter.Environment = environment
+	}
+	if *preferEnv {
+		filter.PreferEnvironment = CurrentEnvironment()
+	}
+	if filter.DateFrom, err = parseDateFlag(dateFrom, false); err != nil {
+		fmt.Fprintf(os.Stderr, "goof search: -from: %v\n", err)
+		return exitError
+	}
+	if filter.DateTo, err = parseDateFlag(dateTo, true); err != nil {
+		fmt.Fprintf(os.Stderr, "goof search: -to: %v\n", err)
+		return exitError
+	}
+
+	var reports []ErrorReport
+	if pipedSymptom != "" {
+		reports, err = FindReportsForSymptom(pipedSymptom, filter)
+	} else {
+		reports, err = SearchErrorReports(filter)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goof search: %v\n", err)
+		return exitError
+	}
+
+	if *asJSON {
+		if reports == nil {
+			reports = []ErrorReport{}
+		}
+		if err := printJSON(reports); err != nil {
+			fmt.Fprintf(os.Stderr, "goof search: %v\n", err)
+			return exitError
+		}
+	} else {
+		for _, report := range reports {
+			fmt.Printf("%s\t%s\t%s\n", report.ID, report.Program, reportSummary(report))
+		}
+	}
+
+	if len(reports) == 0 {
+		return exitNoMatch
+	}
+	return exitOK
+}
+
+// parseDateFlag parses a YYYY-MM-DD date; endOfDay makes the bound inclusive
+func parseDateFlag(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		date = date.Add(24*time.Hour - time.Second)
+	}
+	return &date, nil
+}
+
+func runShowCommand(args []string) int {
+	fs := newFlagSet("show")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return parseExitCode(err)
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: goof show <id> [-json]")
+		return exitError
+	}
+
+	report, err := GetErrorReport(positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goof show: %v\n", err)
+		return exitCodeFor(err)
+	}
+
+	if *asJSON {
+		if err := printJSON(report); err != nil {
+			fmt.Fprintf(os.Stderr, "goof show: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	fmt.Print(formatReport(report))
+	return exitOK
+}
+
+func runAddCommand(args []string) int {
+	fs := newFlagSet("add")
+	var fields reportFlags
+	fields.register(fs)
+	noEnv := fs.Bool("no-env", false, "Do not record the current machine's environment")
+	interactive := fs.Bool("i", false, "Open the entry form pre-filled instead of saving straight away")
+	asJSON := fs.Bool("json", false, "Print the saved report as JSON")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return parseExitCode(err)
+	}
+	if len(positional) > 0 {
+		fmt.Fprintf(os.Stderr, "goof add: unexpected argument %q\n", positional[0])
+		return exitError
+	}
+
+	report := ErrorReport{
+		Resources: []string{},
+		Date:      time.Now(),
+	}
+	if !*noEnv {
+		report.Environment = CurrentEnvironment()
+	}
+	if err := fields.apply(fs, &report); err != nil {
+		fmt.Fprintf(os.Stderr, "goof add: %v\n", err)
+		return exitError
+	}
+	if fields.symptom == "" && fields.symptomFile == "" && stdinIsPiped() {
+		// `goof add < error.txt`
+		if report.Symptom, err = readPipedInput(); err != nil {
+			fmt.Fprintf(os.Stderr, "goof add: %v\n", err)
+			return exitError
+		}
+	}
+
+	if *interactive {
+		if err := runTUI(newEntryModel(report)); err != nil {
+			fmt.Fprintf(os.Stderr, "goof add: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	if strings.TrimSpace(report.Symptom) == "" {
+		fmt.Fprintln(os.Stderr, "goof add: a symptom is required (-symptom or -symptom-file)")
+		return exitError
+	}
+
+	id, err := SaveErrorReport(report)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goof add: %v\n", err)
+		return exitError
+	}
+	report.ID = id
+
+	if *asJSON {
+		if err := printJSON(report); err != nil {
+			fmt.Fprintf(os.Stderr, "goof add: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	fmt.Println(id)
+	return exitOK
+}
+
+func runEditCommand(args []string) int {
+	fs := newFlagSet("edit")
+	var fields reportFlags
+	fields.register(fs)
+	asJSON := fs.Bool("json", false, "Print the updated report as JSON")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return parseExitCode(err)
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: goof edit <id> [flags]")
+		return exitError
+	}
+
+	report, err := GetErrorReport(positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goof edit: %v\n", err)
+		return exitCodeFor(err)
+	}
+	if err := fields.apply(fs, &report); err != nil {
+		fmt.Fprintf(os.Stderr, "goof edit: %v\n", err)
+		return exitError
+	}
+
+	if err := UpdateErrorReport(report, report.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "goof edit: %v\n", err)
+		return exitError
+	}
+
+	if *asJSON {
+		if err := printJSON(report); err != nil {
+			fmt.Fprintf(os.Stderr, "goof edit: %v\n", err)
+			return exitError
+		}
+	}
+	return exitOK
+}
+
+func runDeleteCommand(args []string) int {
+	fs := newFlagSet("delete")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return parseExitCode(err)
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: goof delete <id>")
+		return exitError
+	}
+
+	// Look the report up first so a typo in the ID is reported, since
+	// Meilisearch happily accepts deletes for documents that don't exist
+	if _, err := GetErrorReport(positional[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "goof delete: %v\n", err)
+		return exitCodeFor(err)
+	}
+
+	if err := DeleteErrorReport(positional[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "goof delete: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// parseExitCode treats -h as a successful request for help
+func parseExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitError
+}
+
+func exitCodeFor(err error) int {
+	if errors.Is(err, ErrReportNotFound) {
+		return exitNoMatch
+	}
+	return exitError
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// formatReport renders every field of a report for terminal output
+func formatReport(report ErrorReport) string {
+	s := fmt.Sprintf("ID: %s\n", report.ID)
+	s += fmt.Sprintf("Date: %s\n", report.Date.Format("2006-01-02"))
+	s += fmt.Sprintf("Program: %s %s\n", report.Program, report.ProgramVersion)
+	s += fmt.Sprintf("Distro: %s %s\n", report.Distro, report.DistroVersion)
+	if report.Team != "" {
+		s += fmt.Sprintf("Team: %s\n", report.Team)
+	}
+	if len(report.Environment) > 0 {
+		s += fmt.Sprintf("Environment: %s\n", formatEnvironment(report.Environment, ", "))
+	}
+	if len(report.Resources) > 0 {
+		s += fmt.Sprintf("Resources: %s\n", strings.Join(report.Resources, ", "))
+	}
+	if len(report.Extracted) > 0 {
+		s += fmt.Sprintf("Extracted: %s\n", formatExtracted(report.Extracted, "; "))
+	}
+	if report.Headline != "" {
+		s += fmt.Sprintf("Headline: %s\n", report.Headline)
+	}
+	if report.Fingerprint != "" {
+		s += fmt.Sprintf("Fingerprint: %s\n", report.Fingerprint)
+	}
+	s += fmt.Sprintf("\nSymptom:\n%s\n", report.Symptom)
+	s += fmt.Sprintf("\nSolution:\n%s\n", report.Solution)
+	return s
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+	"github.com/charmbracelet/x/term"
+)
+
+// errPasteUnsupported is returned by clipboards that can only be written
+var errPasteUnsupported = errors.New("this clipboard can't be read")
+
+// clipboardProvider is one way of reaching the system clipboard
+type clipboardProvider interface {
+	Name() string
+	Available() bool
+	Copy(text string) error
+	Paste() (string, error)
+}
+
+// clipboardProviders lists every provider, in the order auto-detection
+// tries them when not connected over SSH
+var clipboardProviders = []clipboardProvider{
+	commandClipboard{"wl-clipboard", []string{"wl-copy"}, []string{"wl-paste", "--no-newline"}, "WAYLAND_DISPLAY"},
+	commandClipboard{"xsel", []string{"xsel", "--clipboard", "--input"}, []string{"xsel", "--clipboard", "--output"}, "DISPLAY"},
+	commandClipboard{"xclip", []string{"xclip", "-selection", "clipboard"}, []string{"xclip", "-selection", "clipboard", "-o"}, "DISPLAY"},
+	commandClipboard{"pbcopy", []string{"pbcopy"}, []string{"pbpaste"}, ""},
+	commandClipboard{"windows", []string{"clip"}, []string{"powershell", "-noprofile", "-command", "Get-Clipboard"}, ""},
+	osc52Clipboard{},
+	fileClipboard{},
+}
+
+// detectClipboard picks the clipboard named by the config, or the first
+// available one. Over SSH, OSC 52 comes first since it reaches the clipboard
+// of the machine the terminal runs on rather than the remote one.
+func detectClipboard(name string) clipboardProvider {
+	if name != "" && name != "auto" {
+		for _, provider := range clipboardProviders {
+			if provider.Name() == name {
+				return provider
+			}
+		}
+		slog.Warn("Unknown clipboard, detecting one instead", "clipboard", name)
+	}
+
+	if os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != "" {
+		if provider := (osc52Clipboard{}); provider.Available() {
+			return provider
+		}
+	}
+	for _, provider := range clipboardProviders {
+		if provider.Available() {
+			slog.Debug("Using clipboard", "clipboard", provider.Name())
+			return provider
+		}
+	}
+	return fileClipboard{}
+}
+
+// commandClipboard shells out to a clipboard tool such as wl-copy or xclip
+type commandClipboard struct {
+	name      string
+	copyArgs  []string
+	pasteArgs []string
+	display   string // Environment variable that must be set, e.g. DISPLAY for X11 tools
+}
+
+func (c commandClipboard) Name() string {
+	return c.name
+}
+
+func (c commandClipboard) Available() bool {
+	if c.display != "" && os.Getenv(c.display) == "" {
+		return false
+	}
+	if _, err := exec.LookPath(c.copyArgs[0]); err != nil {
+		return false
+	}
+	_, err := exec.LookPath(c.pasteArgs[0])
+	return err == nil
+}
+
+func (c commandClipboard) Copy(text string) error {
+	cmd := exec.Command(c.copyArgs[0], c.copyArgs[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run %s: %w", c.copyArgs[0], err)
+	}
+	return nil
+}
+
+func (c commandClipboard) Paste() (string, error) {
+	out, err := exec.Command(c.pasteArgs[0], c.pasteArgs[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s: %w", c.pasteArgs[0], err)
+	}
+	text := strings.ReplaceAll(string(out), "\r\n", "\n")
+	return strings.TrimSuffix(text, "\n"), nil
+}
+
+// osc52Clipboard asks the terminal itself to set the clipboard, which works
+// over SSH and inside tmux or screen. Reading it back needs a reply from the
+// terminal that the TUI can't wait for, so pasting isn't supported.
+type osc52Clipboard struct{}
+
+func (osc52Clipboard) Name() string {
+	return "osc52"
+}
+
+func (osc52Clipboard) Available() bool {
+	return term.IsTerminal(os.Stderr.Fd()) && os.Getenv("TERM") != "dumb"
+}
+
+func (osc52Clipboard) Copy(text string) error {
+	seq := osc52.New(text)
+	switch {
+	case os.Getenv("TMUX") != "":
+		seq = seq.Tmux()
+	case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		seq = seq.Screen()
+	}
+	// stderr, because the TUI owns stdout
+	_, err := seq.WriteTo(os.Stderr)
+	return err
+}
+
+func (osc52Clipboard) Paste() (string, error) {
+	return "", errPasteUnsupported
+}
+
+// fileClipboard keeps the clipboard in a file, so copy and paste still work
+// between goof sessions when nothing else is available
+type fileClipboard struct{}
+
+func (fileClipboard) Name() string {
+	return "file"
+}
+
+func (fileClipboard) Available() bool {
+	return clipboardFilePath() != ""
+}
+
+func (fileClipboard) Copy(text string) error {
+	path := clipboardFilePath()
+	if path == "" {
+		return errors.New("no directory for the clipboard file")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(text), 0o600)
+}
+
+func (fileClipboard) Paste() (string, error) {
+	data, err := os.ReadFile(clipboardFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+// clipboardFilePath is $XDG_STATE_HOME/goof/clipboard
+func clipboardFilePath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	if runtime.GOOS == "windows" {
+		if cache, err := os.UserCacheDir(); err == nil {
+			dir = cache
+		}
+	}
+	return filepath.Join(dir, "goof", "clipboard")
+}
@@ -1,65 +1,251 @@
 package main
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
 )
 
-var (
-	debugEnabled bool
-	debugLogFile string
+// Backends a profile can use
+const (
+	backendMeilisearch = "meilisearch"
+	backendFile        = "file" // Reports in a local JSON file, for working offline
 )
 
 type Config struct {
+	Profile        string // Name of the profile in use, "" without a config file
+	Backend        string
 	MeilisearchURL string
-	MeilisearchKey string
+	MeilisearchKey Secret
+	KeySource      string // Where the key came from, e.g. "key_file ~/.meili-key" or "keyring"
 	IndexName      string
+	StorePath      string // Where the file backend keeps reports
+	Editor         string // Overrides $VISUAL and $EDITOR
+	Clipboard      string // wl-clipboard, xsel, xclip, pbcopy, windows, osc52 or file, or "auto" to detect one
+	Theme          string
+	Redaction      redactionConfig // What's redacted from reports before they're saved
+	Serve          serveConfig     // Settings for goof serve
+
+	EncryptionKeyFile string
+	EncryptionKey     Secret // Encrypts solutions when set, see encryption.go
 }
 
-func LoadConfig() Config {
-	config := Config{
-		MeilisearchURL: getEnvOrDefault("MEILISEARCH_URL", "http://localhost:7700"),
-		MeilisearchKey: getEnvOrDefault("MEILISEARCH_KEY", "aSampleMasterKey"),
-		IndexName:      getEnvOrDefault("MEILISEARCH_INDEX", "error_reports"),
+// profileConfig is one [profiles.<name>] table of the config file
+type profileConfig struct {
+	Backend    string `toml:"backend"`
+	URL        string `toml:"url"`
+	Key        string `toml:"key"`         // The key itself; prefer one of the others
+	KeyEnv     string `toml:"key_env"`     // Environment variable holding the key
+	KeyFile    string `toml:"key_file"`    // File holding the key, which only the user may read
+	KeyCommand string `toml:"key_command"` // Credential helper printing the key
+	Index      string `toml:"index"`
+	Path       string `toml:"path"`
+	Editor     string `toml:"editor"`
+	Clipboard  string `toml:"clipboard"`
+	Theme      string `toml:"theme"`
+
+	EncryptionKeyFile string `toml:"encryption_key_file"`
+}
+
+// configFile is the layout of config.toml. Besides the profiles, it holds
+// tables that apply whichever profile is in use:
+//
+//	[redaction]                         # see redact.go
+//	disabled = false                    # turn redaction off altogether
+//	internal_domains = ["corp.example.com"]
+//	disable = ["hostname"]              # built-in detectors to skip, by name
+//	rules = [{ name = "ticket", pattern = 'SEC-\d+' }]
+//
+//	[[normalize.rules]]                 # see normalize.go; changes fingerprints
+//	name = "build-number"
+//	pattern = 'build #\d+'
+//	replacement = "build #<n>"
+//
+//	[serve]                             # see server.go and openapi.yaml
+//	listen = "127.0.0.1:7780"
+//
+//	[[serve.tokens]]                    # printed by goof serve -new-token
+//	name = "ci"
+//	sha256 = "…"                        # only the token's hash is kept
+//	read_only = true
+type configFile struct {
+	DefaultProfile string                   `toml:"default_profile"`
+	Profiles       map[string]profileConfig `toml:"profiles"`
+	Redaction      redactionConfig          `toml:"redaction"`
+	Normalize      normalizeConfig          `toml:"normalize"`
+	Serve          serveConfig              `toml:"serve"`
+}
+
+// configFlags holds settings given on the command line, which win over
+// everything else. Empty fields are unset.
+var configFlags struct {
+	Profile string
+	Backend string
+	URL     string
+	Index   string
+}
+
+var (
+	loadConfigFileOnce sync.Once
+	loadedConfigFile   configFile
+	loadedConfigErr    error
+)
+
+// configFilePath is $GOOF_CONFIG, or config.toml in the user's config
+// directory ($XDG_CONFIG_HOME/goof on Linux)
+func configFilePath() string {
+	if path := os.Getenv("GOOF_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
 	}
+	return filepath.Join(dir, "goof", "config.toml")
+}
 
-	logToFile("DEBUG: Config loaded - URL: %s, Key: '%s' (len=%d), Index: %s\n",
-		config.MeilisearchURL, config.MeilisearchKey, len(config.MeilisearchKey), config.IndexName)
+// readConfigFile parses the config file once per run. A missing file is not
+// an error; goof then runs on env vars and defaults alone.
+func readConfigFile() (configFile, error) {
+	loadConfigFileOnce.Do(func() {
+		path := configFilePath()
+		if path == "" {
+			return
+		}
+		meta, err := toml.DecodeFile(path, &loadedConfigFile)
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		if err != nil {
+			loadedConfigErr = fmt.Errorf("failed to read config file %s: %w", path, err)
+			return
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			slog.Warn("Ignoring unknown config keys", "path", path, "keys", undecoded)
+		}
+	})
+	return loadedConfigFile, loadedConfigErr
+}
 
-	return config
+// selectedProfile names the profile to use: --profile, then $GOOF_PROFILE,
+// then the file's default_profile, then "default"
+func selectedProfile(file configFile) string {
+	for _, name := range []string{configFlags.Profile, os.Getenv("GOOF_PROFILE"), file.DefaultProfile} {
+		if name != "" {
+			return name
+		}
+	}
+	return "default"
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	value := os.Getenv(key)
-	logToFile("DEBUG: getEnvOrDefault(%s, %s) - env value: '%s' (len=%d)\n",
-		key, defaultValue, value, len(value))
+// currentProfile returns the selected profile from the config file, with ""
+// for its name when there's no such profile
+func currentProfile() (string, profileConfig) {
+	file, err := readConfigFile()
+	if err != nil {
+		slog.Warn("Ignoring the config file", "err", err)
+	}
+
+	name := selectedProfile(file)
+	profile, ok := file.Profiles[name]
+	if !ok {
+		if len(file.Profiles) > 0 || configFlags.Profile != "" {
+			slog.Warn("Profile not found", "profile", name, "path", configFilePath())
+		}
+		name = ""
+	}
+	return name, profile
+}
 
-	if value != "" {
-		logToFile("DEBUG: Using env value: '%s'\n", value)
-		return value
+// LoadConfig resolves every setting from, in order of precedence, command
+// line flags, environment variables, the selected profile of the config file
+// and built-in defaults
+func LoadConfig() Config {
+	name, profile := currentProfile()
+	key, keySource, err := resolveKey(name, profile)
+	if err != nil {
+		slog.Warn("Failed to read the Meilisearch key", "source", keySource, "err", err)
+	}
+
+	config := Config{
+		Profile:        name,
+		Backend:        firstSet(configFlags.Backend, os.Getenv("GOOF_BACKEND"), profile.Backend, backendMeilisearch),
+		MeilisearchURL: firstSet(configFlags.URL, os.Getenv("MEILISEARCH_URL"), profile.URL, "http://localhost:7700"),
+		MeilisearchKey: key,
+		KeySource:      keySource,
+		IndexName:      firstSet(configFlags.Index, os.Getenv("MEILISEARCH_INDEX"), profile.Index, "error_reports"),
+		Editor:         firstSet(os.Getenv("GOOF_EDITOR"), profile.Editor),
+		Clipboard:      firstSet(os.Getenv("GOOF_CLIPBOARD"), profile.Clipboard, "auto"),
+		Theme:          firstSet(os.Getenv("GOOF_THEME"), profile.Theme, "default"),
+	}
+	if file, err := readConfigFile(); err == nil {
+		config.Redaction = file.Redaction
+		config.Serve = file.Serve
 	}
 
-	logToFile("DEBUG: Using default value: '%s'\n", defaultValue)
-	return defaultValue
+	config.EncryptionKeyFile = firstSet(expandHome(os.Getenv("GOOF_ENCRYPTION_KEY_FILE")), expandHome(profile.EncryptionKeyFile), defaultEncryptionKeyPath())
+	if config.EncryptionKey, err = loadEncryptionKey(config.EncryptionKeyFile); err != nil {
+		slog.Warn("Failed to read the encryption key", "path", config.EncryptionKeyFile, "err", err)
+	}
+	config.StorePath = firstSet(os.Getenv("GOOF_STORE_PATH"), expandHome(profile.Path), defaultStorePath(config.IndexName))
+
+	registerSecret(config.MeilisearchKey)
+
+	slog.Debug("Config loaded", "profile", config.Profile, "backend", config.Backend, "url", config.MeilisearchURL,
+		"key", config.MeilisearchKey, "key_len", len(config.MeilisearchKey), "index", config.IndexName)
+
+	return config
 }
 
-func initDebugLogging(enabled bool, logFile string) {
-	debugEnabled = enabled
-	debugLogFile = logFile
+// ProfileNames lists the profiles defined in the config file
+func ProfileNames() []string {
+	file, _ := readConfigFile()
+	names := make([]string, 0, len(file.Profiles))
+	for name := range file.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-func logToFile(format string, args ...interface{}) {
-	if !debugEnabled {
-		return
+// firstSet returns the first non-empty value
+func firstSet(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
 	}
+	return ""
+}
 
-	file, err := os.OpenFile(debugLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
 	if err != nil {
-		log.Printf("Error opening log file: %v", err)
-		return
+		return path
 	}
-	defer file.Close()
+	return filepath.Join(home, rest)
+}
 
-	logger := log.New(file, "", log.LstdFlags)
-	logger.Printf(format, args...)
+// defaultStorePath is $XDG_DATA_HOME/goof/<index>.json
+func defaultStorePath(index string) string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return index + ".json"
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "goof", index+".json")
 }
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+// keyringService is the service name keys are stored under in the keyring
+const keyringService = "goof"
+
+// errNoCredential is returned by credential stores holding no key for a profile
+var errNoCredential = errors.New("no key stored")
+
+// credentialStore is somewhere `goof auth login` can keep a profile's key
+type credentialStore interface {
+	Name() string
+	Get(profile string) (string, error)
+	Set(profile, key string) error
+}
+
+// credentialStores lists the stores in the order they're tried: the system
+// keyring (Secret Service, Keychain or Credential Manager), then a file
+var credentialStores = []credentialStore{
+	keyringCredentials{},
+	fileCredentials{},
+}
+
+// keyringCredentials keeps keys in the system keyring
+type keyringCredentials struct{}
+
+func (keyringCredentials) Name() string {
+	return "keyring"
+}
+
+func (keyringCredentials) Get(profile string) (string, error) {
+	key, err := keyring.Get(keyringService, profile)
+	if err != nil {
+		// Without a reachable keyring (no Secret Service over SSH, say) there's
+		// simply nothing stored in it
+		if !errors.Is(err, keyring.ErrNotFound) {
+			slog.Debug("Keyring unavailable", "err", err)
+		}
+		return "", errNoCredential
+	}
+	return key, nil
+}
+
+func (keyringCredentials) Set(profile, key string) error {
+	return keyring.Set(keyringService, profile, key)
+}
+
+// fileCredentials keeps each profile's key in its own file, readable only by
+// the user, for machines without a keyring
+type fileCredentials struct{}
+
+func (fileCredentials) Name() string {
+	return "file"
+}
+
+func (fileCredentials) Get(profile string) (string, error) {
+	key, err := readKeyFile(credentialFilePath(profile))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errNoCredential
+	}
+	return key, err
+}
+
+func (fileCredentials) Set(profile, key string) error {
+	path := credentialFilePath(profile)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(key+"\n"), 0o600)
+}
+
+// credentialFilePath is credentials/<profile> next to the config file
+func credentialFilePath(profile string) string {
+	return filepath.Join(filepath.Dir(configFilePath()), "credentials", profile)
+}
+
+// saveCredential stores key for profile in the first store that takes it and
+// returns that store's name
+func saveCredential(profile, key string) (string, error) {
+	var errs []error
+	for _, store := range credentialStores {
+		err := store.Set(profile, key)
+		if err == nil {
+			forgetResolvedKeys()
+			return store.Name(), nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", store.Name(), err))
+	}
+	return "", fmt.Errorf("failed to store key: %w", errors.Join(errs...))
+}
+
+// readKeyFile reads a key from a file, refusing files other users can read
+func readKeyFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("key file %s is accessible by other users (mode %v); run chmod 600 on it", path, info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// runKeyCommand runs a credential helper through the shell and takes the
+// first line it prints as the key, like git's credential helpers
+func runKeyCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/c", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run key command: %w", err)
+	}
+	key, _, _ := strings.Cut(string(out), "\n")
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", errors.New("key command printed nothing")
+	}
+	return key, nil
+}
+
+var (
+	resolvedKeysMu sync.Mutex
+	resolvedKeys   = map[string]resolvedKey{}
+)
+
+type resolvedKey struct {
+	key    Secret
+	source string
+	err    error
+}
+
+// forgetResolvedKeys makes the next LoadConfig look keys up again
+func forgetResolvedKeys() {
+	resolvedKeysMu.Lock()
+	defer resolvedKeysMu.Unlock()
+	resolvedKeys = map[string]resolvedKey{}
+}
+
+// resolveKey finds the key for a profile and says where it came from. In
+// order: $MEILISEARCH_KEY, $MEILISEARCH_KEY_FILE, the profile's key_command,
+// key_file, key_env and key, then a key stored by `goof auth login`. Lookups
+// are cached, since LoadConfig runs often and a helper may be slow or prompt.
+func resolveKey(name string, profile profileConfig) (Secret, string, error) {
+	if key := os.Getenv("MEILISEARCH_KEY"); key != "" {
+		return Secret(key), "$MEILISEARCH_KEY", nil
+	}
+
+	cacheKey := strings.Join([]string{name, os.Getenv("MEILISEARCH_KEY_FILE"), profile.KeyCommand, profile.KeyFile, profile.KeyEnv}, "\x00")
+	resolvedKeysMu.Lock()
+	defer resolvedKeysMu.Unlock()
+	if resolved, ok := resolvedKeys[cacheKey]; ok {
+		return resolved.key, resolved.source, resolved.err
+	}
+
+	key, source, err := lookUpKey(name, profile)
+	resolvedKeys[cacheKey] = resolvedKey{Secret(key), source, err}
+	return Secret(key), source, err
+}
+
+func lookUpKey(name string, profile profileConfig) (string, string, error) {
+	if path := os.Getenv("MEILISEARCH_KEY_FILE"); path != "" {
+		key, err := readKeyFile(expandHome(path))
+		return key, "$MEILISEARCH_KEY_FILE", err
+	}
+	if profile.KeyCommand != "" {
+		key, err := runKeyCommand(profile.KeyCommand)
+		return key, "key_command", err
+	}
+	if profile.KeyFile != "" {
+		key, err := readKeyFile(expandHome(profile.KeyFile))
+		return key, "key_file " + profile.KeyFile, err
+	}
+	if profile.KeyEnv != "" {
+		return os.Getenv(profile.KeyEnv), "$" + profile.KeyEnv, nil
+	}
+	if profile.Key != "" {
+		return profile.Key, "key in " + configFilePath(), nil
+	}
+
+	if name == "" {
+		name = "default"
+	}
+	for _, store := range credentialStores {
+		key, err := store.Get(name)
+		if err == nil {
+			return key, store.Name(), nil
+		}
+		if !errors.Is(err, errNoCredential) {
+			return "", store.Name(), fmt.Errorf("failed to read key from %s: %w", store.Name(), err)
+		}
+	}
+	return "", "", nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is a single compiler message pulled out of a symptom
+type Diagnostic struct {
+	File     string       `json:"file,omitempty"`
+	Line     int          `json:"line,omitempty"`
+	Column   int          `json:"column,omitempty"`
+	Severity string       `json:"severity"`       // error, fatal error, warning, note, help
+	Message  string       `json:"message"`        // The message without location or flag
+	Flag     string       `json:"flag,omitempty"` // -Wfoo for gcc/clang, the error code for rustc
+	Notes    []Diagnostic `json:"notes,omitempty"`
+}
+
+// diagnosticParser recognizes one compiler's output format
+type diagnosticParser struct {
+	name   string
+	detect func(text string) bool
+	parse  func(text string) []Diagnostic
+}
+
+// diagnosticParsers are tried in order; the first one whose detect matches wins.
+// clang comes before gcc because their formats are nearly identical and
+// clang's output has the more distinctive markers.
+var diagnosticParsers = []diagnosticParser{
+	{"rustc", detectRustc, parseRustcDiagnostics},
+	{"go", detectGoBuild, parseGoBuildDiagnostics},
+	{"clang", detectClang, parseGCCStyleDiagnostics},
+	{"gcc", detectGCC, parseGCCStyleDiagnostics},
+}
+
+// ParseDiagnostics turns compiler output into structured diagnostics and
+// reports which compiler it came from
+func ParseDiagnostics(text string) (string, []Diagnostic) {
+	for _, parser := range diagnosticParsers {
+		if !parser.detect(text) {
+			continue
+		}
+		if diagnostics := parser.parse(text); len(diagnostics) > 0 {
+			return parser.name, diagnostics
+		}
+	}
+	return "", nil
+}
+
+// primaryDiagnostic returns the first error, or the first diagnostic of any
+// severity when there are no errors
+func primaryDiagnostic(diagnostics []Diagnostic) *Diagnostic {
+	for i := range diagnostics {
+		if strings.Contains(diagnostics[i].Severity, "error") {
+			return &diagnostics[i]
+		}
+	}
+	if len(diagnostics) > 0 {
+		return &diagnostics[0]
+	}
+	return nil
+}
+
+// deriveHeadline picks the line that best summarizes a symptom: the primary
+// compiler message, or the exception of a runtime traceback
+func deriveHeadline(symptom string) string {
+	_, diagnostics := ParseDiagnostics(symptom)
+	if primary := primaryDiagnostic(diagnostics); primary != nil {
+		return primary.Severity + ": " + primary.Message
+	}
+	if traceback := ParseTraceback(symptom); traceback != nil {
+		return getFirstLine(traceback.Summary())
+	}
+	return ""
+}
+
+// symptomQuery is the text to search for when looking up a fresh symptom
+func symptomQuery(symptom string) string {
+	_, diagnostics := ParseDiagnostics(symptom)
+	if primary := primaryDiagnostic(diagnostics); primary != nil {
+		return primary.Message
+	}
+	if traceback := ParseTraceback(symptom); traceback != nil {
+		return getFirstLine(traceback.Summary())
+	}
+	return getFirstLine(extractErrorText(symptom))
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// attachDiagnostic appends d, folding notes into the diagnostic they explain
+func attachDiagnostic(diagnostics []Diagnostic, d Diagnostic) []Diagnostic {
+	if (d.Severity == "note" || d.Severity == "help") && len(diagnostics) > 0 {
+		last := &diagnostics[len(diagnostics)-1]
+		last.Notes = append(last.Notes, d)
+		return diagnostics
+	}
+	return append(diagnostics, d)
+}
+
+// gcc and clang
+
+var (
+	// file:line:col: severity: message [-Wflag]
+	gccLocatedPattern = regexp.MustCompile(`^([^:\s][^:]*):(\d+):(?:(\d+):)?\s*(fatal error|error|warning|note|remark):\s*(.*)$`)
+	// cc1plus: error: message, for diagnostics without a location
+	gccDriverPattern = regexp.MustCompile(`^(cc1\w*|collect2|gcc(?:-\d+)?|g\+\+(?:-\d+)?|clang(?:\+\+)?(?:-\d+)?|c\+\+|cc): (fatal error|error|warning|note): (.*)$`)
+	gccFlagPattern   = regexp.MustCompile(`\s*\[(-W[^\]]*|-f[^\]]*)\]$`)
+	clangMarker      = regexp.MustCompile(`(?m)^\d+ (?:errors?|warnings?)(?: and \d+ (?:errors?|warnings?))? generated\.$|^clang(?:\+\+)?(?:-\d+)?: `)
+)
+
+func detectClang(text string) bool {
+	return clangMarker.MatchString(text)
+}
+
+func detectGCC(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if gccLocatedPattern.MatchString(line) || gccDriverPattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseGCCStyleDiagnostics(text string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		var d Diagnostic
+		if m := gccLocatedPattern.FindStringSubmatch(line); m != nil {
+			d = Diagnostic{
+				File:     m[1],
+				Line:     atoi(m[2]),
+				Column:   atoi(m[3]),
+				Severity: m[4],
+				Message:  m[5],
+			}
+		} else if m := gccDriverPattern.FindStringSubmatch(line); m != nil {
+			d = Diagnostic{Severity: m[2], Message: m[3]}
+		} else {
+			continue
+		}
+
+		if m := gccFlagPattern.FindStringSubmatch(d.Message); m != nil {
+			d.Flag = m[1]
+			d.Message = strings.TrimSuffix(d.Message, m[0])
+		}
+		diagnostics = attachDiagnostic(diagnostics, d)
+	}
+	return diagnostics
+}
+
+// rustc
+
+var (
+	rustcHeaderPattern   = regexp.MustCompile(`^(error|warning|note|help)(?:\[(\w+)\])?: (.*)$`)
+	rustcLocationPattern = regexp.MustCompile(`^\s*--> (.+):(\d+):(\d+)$`)
+	rustcLocationLine    = regexp.MustCompile(`(?m)^\s*--> .+:\d+:\d+$`)
+	rustcNotePattern     = regexp.MustCompile(`^\s*= (note|help): (.*)$`)
+	rustcLintPattern     = regexp.MustCompile("`#\\[(?:warn|deny|forbid)\\(([\\w:]+)\\)\\]`")
+	// Summary lines that repeat what the real diagnostics already said
+	rustcSummaryPattern = regexp.MustCompile(`^(aborting due to|could not compile|build failed|` + "`" + `.*` + "`" + ` \(.*\) generated \d+ warning)`)
+)
+
+func detectRustc(text string) bool {
+	return strings.Contains(text, "error[E") || rustcLocationLine.MatchString(text)
+}
+
+func parseRustcDiagnostics(text string) []Diagnostic {
+	var diagnostics []Diagnostic
+	var current *Diagnostic
+	// A note: or help: header with its own span is folded into current as a
+	// note, and the --> line that follows is that note's location
+	subNote := -1
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if m := rustcHeaderPattern.FindStringSubmatch(line); m != nil {
+			if rustcSummaryPattern.MatchString(m[3]) {
+				current = nil
+				continue
+			}
+			diagnostics = attachDiagnostic(diagnostics, Diagnostic{Severity: m[1], Flag: m[2], Message: m[3]})
+			current = &diagnostics[len(diagnostics)-1]
+			subNote = -1
+			if m[1] == "note" || m[1] == "help" {
+				subNote = len(current.Notes) - 1
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		if m := rustcLocationPattern.FindStringSubmatch(line); m != nil {
+			located := current
+			if subNote >= 0 {
+				located = &current.Notes[subNote]
+			}
+			if located.File == "" {
+				located.File = m[1]
+				located.Line = atoi(m[2])
+				located.Column = atoi(m[3])
+			}
+		} else if m := rustcNotePattern.FindStringSubmatch(line); m != nil {
+			current.Notes = append(current.Notes, Diagnostic{Severity: m[1], Message: m[2]})
+			// Lints name themselves in a note rather than an error code
+			if lint := rustcLintPattern.FindStringSubmatch(m[2]); lint != nil && current.Flag == "" {
+				current.Flag = lint[1]
+			}
+		}
+	}
+	return diagnostics
+}
+
+// go build
+
+var (
+	goBuildPattern       = regexp.MustCompile(`^(\S+\.go):(\d+):(\d+): (.*)$`)
+	goBuildPackageHeader = regexp.MustCompile(`^# \S+$`)
+)
+
+func detectGoBuild(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if goBuildPattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseGoBuildDiagnostics(text string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if goBuildPackageHeader.MatchString(line) {
+			continue
+		}
+
+		if m := goBuildPattern.FindStringSubmatch(line); m != nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				File:     m[1],
+				Line:     atoi(m[2]),
+				Column:   atoi(m[3]),
+				Severity: "error",
+				Message:  m[4],
+			})
+		} else if strings.HasPrefix(line, "\t") && len(diagnostics) > 0 {
+			// Continuation lines, e.g. "\thave (int)\n\twant (string)"
+			last := &diagnostics[len(diagnostics)-1]
+			last.Notes = append(last.Notes, Diagnostic{Severity: "note", Message: strings.TrimSpace(line)})
+		}
+	}
+	return diagnostics
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "Rewrite the golden files from the current output")
+
+// parsedSymptom is what the golden files record for each sample
+type parsedSymptom struct {
+	Compiler    string       `json:"compiler"`
+	Headline    string       `json:"headline"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// TestParseDiagnosticsGolden parses compiler output captured in
+// testdata/diagnostics/<compiler>.txt and compares it with <compiler>.golden.
+// Run with -update after a deliberate change to the parsers.
+func TestParseDiagnosticsGolden(t *testing.T) {
+	samples, err := filepath.Glob(filepath.Join("testdata", "diagnostics", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) == 0 {
+		t.Fatal("no samples in testdata/diagnostics")
+	}
+
+	for _, sample := range samples {
+		name := strings.TrimSuffix(filepath.Base(sample), ".txt")
+		t.Run(name, func(t *testing.T) {
+			input, err := os.ReadFile(sample)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compiler, diagnostics := ParseDiagnostics(string(input))
+			if compiler != name {
+				t.Errorf("detected compiler %q, want %q", compiler, name)
+			}
+			got, err := json.MarshalIndent(parsedSymptom{compiler, deriveHeadline(string(input)), diagnostics}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := strings.TrimSuffix(sample, ".txt") + ".golden"
+			if *updateGolden {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("parsed %s differs from %s:\n%s", sample, golden, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// keyActions are the Meilisearch actions goof uses, with what each is for
+var keyActions = []struct {
+	action, use string
+}{
+	{"search", "searching"},
+	{"documents.get", "listing reports"},
+	{"documents.add", "saving reports"},
+	{"documents.delete", "deleting reports"},
+	{"settings.get", "checking index settings"},
+	{"settings.update", "goof -init-index"},
+}
+
+// doctor runs checks one after another, printing each result with a
+// suggested fix for anything wrong
+type doctor struct {
+	w          io.Writer
+	problems   int
+	repairable bool // A problem that Initialize fixes was found
+}
+
+func (d *doctor) ok(format string, args ...interface{}) {
+	fmt.Fprintf(d.w, "ok    %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) info(format string, args ...interface{}) {
+	fmt.Fprintf(d.w, "note  %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) fail(problem, fix string) {
+	d.problems++
+	fmt.Fprintf(d.w, "FAIL  %s\n", problem)
+	if fix != "" {
+		fmt.Fprintf(d.w, "      fix: %s\n", fix)
+	}
+}
+
+func runDoctorCommand(args []string) int {
+	fs := newFlagSet("doctor")
+	fix := fs.Bool("fix", false, "Repair the index settings without asking")
+	if _, err := parseArgs(fs, args); err != nil {
+		return parseExitCode(err)
+	}
+
+	config := LoadConfig()
+	fmt.Printf("Profile %s, %s backend\n\n", profileOrDefault(config), config.Backend)
+	d := runChecks(config)
+
+	if d.repairable {
+		repair := *fix
+		if !repair && term.IsTerminal(os.Stdin.Fd()) {
+			fmt.Println()
+			repair = promptKey("Repair the index now? [y/N] ") == 'y'
+		}
+		if repair {
+			if err := InitializeIndexIfNeeded(); err != nil {
+				fmt.Fprintf(os.Stderr, "goof doctor: %v\n", err)
+				return exitError
+			}
+			fmt.Print("\nRepaired the index, checking again:\n\n")
+			d = runChecks(config)
+		}
+	}
+
+	fmt.Println()
+	if d.problems > 0 {
+		fmt.Printf("%d problem(s) found\n", d.problems)
+		return exitError
+	}
+	fmt.Println("No problems found")
+	return exitOK
+}
+
+func runChecks(config Config) *doctor {
+	d := &doctor{w: os.Stdout}
+	switch config.Backend {
+	case backendMeilisearch:
+		d.checkMeilisearch(config)
+	case backendFile:
+		d.checkFileStore(config)
+	default:
+		d.fail(fmt.Sprintf("unknown backend %q", config.Backend),
+			fmt.Sprintf("set backend to %q or %q in your profile, or pass -backend", backendMeilisearch, backendFile))
+	}
+	return d
+}
+
+func (d *doctor) checkMeilisearch(config Config) {
+	if u, err := url.Parse(config.MeilisearchURL); err != nil || u.Scheme == "" || u.Host == "" {
+		d.fail(fmt.Sprintf("%q is not a valid URL", config.MeilisearchURL),
+			"set url in your profile, MEILISEARCH_URL or -url to e.g. http://localhost:7700")
+		return
+	}
+
+	client := meilisearch.New(config.MeilisearchURL, meilisearch.WithAPIKey(config.MeilisearchKey.Reveal()))
+	health, err := client.Health()
+	if err != nil {
+		d.fail(fmt.Sprintf("can't reach Meilisearch at %s: %v", config.MeilisearchURL, err),
+			"check the URL and that Meilisearch is running")
+		return
+	}
+	if health.Status != "available" {
+		d.fail(fmt.Sprintf("Meilisearch at %s reports status %q", config.MeilisearchURL, health.Status),
+			"check the Meilisearch server's logs")
+		return
+	}
+	d.ok("Meilisearch at %s is available", config.MeilisearchURL)
+
+	if version, err := client.Version(); err == nil {
+		d.ok("Meilisearch version %s", version.PkgVersion)
+	} else {
+		// Keys without the version action can't see it, which is harmless
+		d.info("couldn't get the Meilisearch version: %v", err)
+	}
+
+	if config.MeilisearchKey == "" {
+		d.info("no key configured, which only works if the server has no master key")
+	} else {
+		d.checkKey(client, config)
+	}
+
+	index, err := client.GetIndex(config.IndexName)
+	if err != nil {
+		var meiliErr *meilisearch.Error
+		if errors.As(err, &meiliErr) && meiliErr.StatusCode == http.StatusNotFound {
+			d.repairable = true
+			d.fail(fmt.Sprintf("index %s doesn't exist", config.IndexName),
+				"run goof doctor -fix or goof -init-index to create it, or set index in your profile if the name is wrong")
+			return
+		}
+		if !d.checkAuthError(err, config) {
+			d.fail(fmt.Sprintf("couldn't read index %s: %v", config.IndexName, err), "")
+		}
+		return
+	}
+	d.ok("index %s exists", config.IndexName)
+	if index.PrimaryKey != "" && index.PrimaryKey != "id" {
+		d.fail(fmt.Sprintf("index %s uses %q as its primary key instead of \"id\"", config.IndexName, index.PrimaryKey),
+			"point goof at a new index; the primary key can't be changed once documents exist")
+	}
+
+	d.checkSettings(client.Index(config.IndexName), config)
+
+	stats, err := client.Index(config.IndexName).GetStats()
+	if err != nil {
+		d.info("couldn't count documents: %v", err)
+		return
+	}
+	if stats.NumberOfDocuments == 0 {
+		d.info("index %s holds no reports yet", config.IndexName)
+	} else {
+		d.ok("index %s holds %d reports", config.IndexName, stats.NumberOfDocuments)
+	}
+	if stats.IsIndexing {
+		d.info("Meilisearch is still indexing; new reports may not show up in searches yet")
+	}
+}
+
+// checkAuthError reports err if it means the key was refused, returning
+// whether it did
+func (d *doctor) checkAuthError(err error, config Config) bool {
+	var meiliErr *meilisearch.Error
+	if !errors.As(err, &meiliErr) {
+		return false
+	}
+	switch meiliErr.StatusCode {
+	case http.StatusUnauthorized:
+		d.fail("the server wants a key and none was sent", "run goof auth login, or set key_file or key_command in your profile")
+	case http.StatusForbidden:
+		d.fail(fmt.Sprintf("the key (from %s) was rejected: %s", config.KeySource, meiliErr.MeilisearchApiError.Message),
+			"check the key with goof auth status, or log in again with goof auth login")
+	default:
+		return false
+	}
+	return true
+}
+
+// checkKey lists the actions goof needs that the key lacks. Keys that can't
+// read their own details (most without keys.get) are only checked by use.
+func (d *doctor) checkKey(client meilisearch.ServiceManager, config Config) {
+	key, err := client.GetKey(config.MeilisearchKey.Reveal())
+	if err != nil {
+		if !d.checkAuthError(err, config) {
+			d.info("can't inspect the key's permissions (it may lack keys.get); checking by use instead")
+		}
+		return
+	}
+
+	if !slices.Contains(key.Indexes, "*") && !slices.Contains(key.Indexes, config.IndexName) {
+		d.fail(fmt.Sprintf("the key has no access to index %s (only %s)", config.IndexName, strings.Join(key.Indexes, ", ")),
+			"use a key for this index, or set index in your profile")
+	}
+	var missing []string
+	for _, needed := range keyActions {
+		if !keyAllows(key.Actions, needed.action) {
+			missing = append(missing, fmt.Sprintf("%s (%s)", needed.action, needed.use))
+		}
+	}
+	if len(missing) > 0 {
+		d.fail("the key lacks "+strings.Join(missing, ", "), "create a key with these actions, or use the master key for goof -init-index")
+		return
+	}
+	if !key.ExpiresAt.IsZero() {
+		d.ok("key %q has the permissions goof needs, until %s", key.Name, key.ExpiresAt.Format("2006-01-02"))
+		return
+	}
+	d.ok("key %q has the permissions goof needs", key.Name)
+}
+
+// keyAllows reports whether a key's actions include action, directly or
+// through a wildcard such as "documents.*"
+func keyAllows(actions []string, action string) bool {
+	group, _, _ := strings.Cut(action, ".")
+	return slices.Contains(actions, "*") || slices.Contains(actions, action) || slices.Contains(actions, group+".*")
+}
+
+// checkSettings compares the index settings with what Initialize applies
+func (d *doctor) checkSettings(index meilisearch.IndexManager, config Config) {
+	searchable, err := index.GetSearchableAttributes()
+	if err != nil {
+		if !d.checkAuthError(err, config) {
+			d.info("couldn't read the index settings: %v", err)
+		}
+		return
+	}
+	if !slices.Equal(*searchable, indexSearchableAttributes) {
+		d.repairable = true
+		d.fail(fmt.Sprintf("searchable attributes are [%s], want [%s]", strings.Join(*searchable, ", "), strings.Join(indexSearchableAttributes, ", ")),
+			"run goof doctor -fix or goof -init-index")
+	} else {
+		d.ok("searchable attributes are set up")
+	}
+
+	filterable, err := index.GetFilterableAttributes()
+	if err != nil {
+		d.info("couldn't read the filterable attributes: %v", err)
+		return
+	}
+	if missing := missingFilterableAttributes(*filterable); len(missing) > 0 {
+		d.repairable = true
+		d.fail("these attributes aren't filterable: "+strings.Join(missing, ", "), "run goof doctor -fix or goof -init-index")
+	} else {
+		d.ok("filterable attributes are set up")
+	}
+}
+
+func (d *doctor) checkFileStore(config Config) {
+	if _, err := os.Stat(config.StorePath); errors.Is(err, os.ErrNotExist) {
+		d.repairable = true
+		d.fail(fmt.Sprintf("%s doesn't exist", config.StorePath), "run goof doctor -fix or goof -init-index to create it, or set path in your profile")
+		return
+	}
+	reports, err := (fileStore{config.StorePath}).All()
+	if err != nil {
+		d.fail(err.Error(), "fix or move the file aside; it must hold a JSON array of reports")
+		return
+	}
+	d.ok("%s holds %d reports", config.StorePath, len(reports))
+}
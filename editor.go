@@ -0,0 +1,652 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/rivo/uniseg"
+)
+
+const (
+	defaultEditorWidth  = 70
+	defaultEditorHeight = 15
+	tabWidth            = 4
+)
+
+const editorHelp = "\nPress Ctrl+S to save, Esc to cancel, Enter for new line" +
+	"\nArrows/Home/End to move, Ctrl+arrows by word, Shift+arrows to select, Ctrl+A for all" +
+	"\nCtrl+C to copy the selection or line, Alt+C the whole field, Ctrl+V to paste, Ctrl+Z/Ctrl+Y to undo/redo" +
+	"\nCtrl+E to open in $EDITOR"
+
+// editorPos is a position in the editor: a line and a byte offset into it
+// that always falls on a grapheme cluster boundary
+type editorPos struct {
+	row, col int
+}
+
+func (p editorPos) before(o editorPos) bool {
+	return p.row < o.row || (p.row == o.row && p.col < o.col)
+}
+
+// textEditor is the multi-line editor behind stateEntryField and
+// stateEditResultField. It moves by grapheme cluster rather than byte, so
+// gcc's curly quotes, accented characters and emoji are never split, and
+// soft-wraps and scrolls long lines to fit the terminal.
+type textEditor struct {
+	lines  []string
+	cursor editorPos
+	anchor *editorPos // Other end of the selection, nil when nothing is selected
+	goalX  int        // Display column kept while moving up and down, -1 when unset
+
+	width  int // Columns of text before soft wrapping
+	height int // Visual rows shown before scrolling
+	scroll int // First visual row shown
+
+	history *editHistory // Shared with the model so it outlives the editor
+}
+
+func newTextEditor(text string) textEditor {
+	e := textEditor{
+		lines:   []string{""},
+		goalX:   -1,
+		width:   defaultEditorWidth,
+		height:  defaultEditorHeight,
+		history: &editHistory{},
+	}
+	e.insert(text)
+	e.cursor = editorPos{}
+	e.scroll = 0
+	return e
+}
+
+// Value returns the edited text
+func (e textEditor) Value() string {
+	return strings.Join(e.lines, "\n")
+}
+
+// CurrentLine returns the line the cursor is on
+func (e textEditor) CurrentLine() string {
+	return e.lines[e.cursor.row]
+}
+
+// SetSize fits the editor to the space it has on screen
+func (e *textEditor) SetSize(width, height int) {
+	e.width = max(width, 10)
+	e.height = max(height, 3)
+	e.ensureVisible()
+}
+
+// HandleKey applies a key press: typing, pasting, cursor and word motions,
+// selection with shift, deletion, and undo/redo
+func (e *textEditor) HandleKey(msg tea.KeyMsg) {
+	if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+		if msg.Alt && !msg.Paste {
+			switch string(msg.Runes) {
+			case "b":
+				e.moveTo(e.wordLeft(e.cursor), false)
+			case "f":
+				e.moveTo(e.wordRight(e.cursor), false)
+			case "d":
+				e.record(editOther)
+				e.deleteTo(e.wordRight(e.cursor))
+			}
+			return
+		}
+
+		text := string(msg.Runes)
+		if msg.Paste {
+			e.record(editOther)
+		} else {
+			e.record(editTyping)
+		}
+		e.insert(text)
+		if strings.TrimSpace(text) == "" {
+			// Each typed word is undone on its own
+			e.history.seal()
+		}
+		return
+	}
+
+	switch msg.String() {
+	case "ctrl+z":
+		e.Undo()
+		return
+	case "ctrl+y":
+		e.Redo()
+		return
+	case "enter":
+		e.record(editOther)
+		e.insert("\n")
+		return
+	case "backspace", "ctrl+h":
+		e.record(editDeleting)
+		e.deleteTo(e.left(e.cursor))
+		return
+	case "delete", "ctrl+d":
+		e.record(editDeleting)
+		e.deleteTo(e.right(e.cursor))
+		return
+	case "ctrl+w", "alt+backspace":
+		e.record(editOther)
+		e.deleteTo(e.wordLeft(e.cursor))
+		return
+	case "ctrl+delete":
+		e.record(editOther)
+		e.deleteTo(e.wordRight(e.cursor))
+		return
+	}
+
+	// Anything else moves the cursor, which ends a run of typing
+	e.history.seal()
+	switch msg.String() {
+	case "ctrl+a":
+		last := len(e.lines) - 1
+		e.anchor = &editorPos{}
+		e.cursor = editorPos{last, len(e.lines[last])}
+		e.goalX = -1
+
+	case "left", "shift+left":
+		e.moveTo(e.left(e.cursor), msg.Type == tea.KeyShiftLeft)
+	case "right", "shift+right":
+		e.moveTo(e.right(e.cursor), msg.Type == tea.KeyShiftRight)
+	case "ctrl+left", "ctrl+shift+left", "alt+left":
+		e.moveTo(e.wordLeft(e.cursor), msg.Type == tea.KeyCtrlShiftLeft)
+	case "ctrl+right", "ctrl+shift+right", "alt+right":
+		e.moveTo(e.wordRight(e.cursor), msg.Type == tea.KeyCtrlShiftRight)
+	case "up", "shift+up":
+		e.moveVertically(-1, msg.Type == tea.KeyShiftUp)
+	case "down", "shift+down":
+		e.moveVertically(1, msg.Type == tea.KeyShiftDown)
+	case "pgup":
+		e.moveVertically(-e.height, false)
+	case "pgdown":
+		e.moveVertically(e.height, false)
+	case "home", "shift+home":
+		e.moveTo(editorPos{e.cursor.row, 0}, msg.Type == tea.KeyShiftHome)
+	case "end", "shift+end":
+		e.moveTo(editorPos{e.cursor.row, len(e.CurrentLine())}, msg.Type == tea.KeyShiftEnd)
+	case "ctrl+home", "ctrl+shift+home":
+		e.moveTo(editorPos{}, msg.Type == tea.KeyCtrlShiftHome)
+	case "ctrl+end", "ctrl+shift+end":
+		last := len(e.lines) - 1
+		e.moveTo(editorPos{last, len(e.lines[last])}, msg.Type == tea.KeyCtrlShiftEnd)
+	}
+}
+
+// InsertText inserts text at the cursor, replacing the selection
+func (e *textEditor) InsertText(text string) {
+	e.record(editOther)
+	e.insert(text)
+}
+
+// SetText replaces all of the text as a single undoable edit
+func (e *textEditor) SetText(text string) {
+	e.record(editOther)
+	e.lines = []string{""}
+	e.cursor = editorPos{}
+	e.anchor = nil
+	e.insert(text)
+	e.cursor = editorPos{}
+	e.scroll = 0
+}
+
+// Undo reverts the last edit, or run of typing
+func (e *textEditor) Undo() {
+	if state, ok := e.history.undo(e.state()); ok {
+		e.restore(state)
+	}
+}
+
+// Redo reapplies the last undone edit
+func (e *textEditor) Redo() {
+	if state, ok := e.history.redo(e.state()); ok {
+		e.restore(state)
+	}
+}
+
+func (e textEditor) state() editorState {
+	return editorState{e.lines, e.cursor}
+}
+
+func (e *textEditor) restore(state editorState) {
+	e.lines = state.lines
+	e.cursor = state.cursor
+	e.anchor = nil
+	e.goalX = -1
+	e.ensureVisible()
+}
+
+// record saves the text before an edit of the given kind, unless it
+// continues the run of edits the last saved state already covers
+func (e *textEditor) record(kind editKind) {
+	e.history.record(e.state(), kind)
+}
+
+// SelectedText returns the selected text, or "" when nothing is selected
+func (e textEditor) SelectedText() string {
+	start, end, ok := e.selection()
+	if !ok {
+		return ""
+	}
+	if start.row == end.row {
+		return e.lines[start.row][start.col:end.col]
+	}
+	parts := []string{e.lines[start.row][start.col:]}
+	parts = append(parts, e.lines[start.row+1:end.row]...)
+	parts = append(parts, e.lines[end.row][:end.col])
+	return strings.Join(parts, "\n")
+}
+
+// selection returns the selected range in document order
+func (e textEditor) selection() (start, end editorPos, ok bool) {
+	if e.anchor == nil || *e.anchor == e.cursor {
+		return e.cursor, e.cursor, false
+	}
+	if e.anchor.before(e.cursor) {
+		return *e.anchor, e.cursor, true
+	}
+	return e.cursor, *e.anchor, true
+}
+
+func (e *textEditor) insert(text string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	if start, end, ok := e.selection(); ok {
+		e.deleteRange(start, end)
+	}
+	e.anchor = nil
+	e.goalX = -1
+
+	row := e.cursor.row
+	line := e.lines[row]
+	inserted := strings.Split(text, "\n")
+	last := len(inserted) - 1
+	before, after := line[:e.cursor.col], line[e.cursor.col:]
+	inserted[0] = before + inserted[0]
+	e.cursor = editorPos{row + last, len(inserted[last])}
+	inserted[last] += after
+
+	lines := make([]string, 0, len(e.lines)+last)
+	lines = append(lines, e.lines[:row]...)
+	lines = append(lines, inserted...)
+	lines = append(lines, e.lines[row+1:]...)
+	e.lines = lines
+	e.ensureVisible()
+}
+
+// deleteTo deletes from the cursor to pos, or the selection if there is one
+func (e *textEditor) deleteTo(pos editorPos) {
+	start, end, ok := e.selection()
+	if !ok {
+		start, end = e.cursor, pos
+		if end.before(start) {
+			start, end = end, start
+		}
+	}
+	e.deleteRange(start, end)
+	e.anchor = nil
+	e.goalX = -1
+	e.ensureVisible()
+}
+
+func (e *textEditor) deleteRange(start, end editorPos) {
+	lines := make([]string, 0, len(e.lines)-(end.row-start.row))
+	lines = append(lines, e.lines[:start.row]...)
+	lines = append(lines, e.lines[start.row][:start.col]+e.lines[end.row][end.col:])
+	lines = append(lines, e.lines[end.row+1:]...)
+	e.lines = lines
+	e.cursor = start
+}
+
+func (e *textEditor) moveTo(pos editorPos, extend bool) {
+	if extend && e.anchor == nil {
+		anchor := e.cursor
+		e.anchor = &anchor
+	} else if !extend {
+		e.anchor = nil
+	}
+	e.cursor = pos
+	e.goalX = -1
+	e.ensureVisible()
+}
+
+func (e textEditor) left(pos editorPos) editorPos {
+	if pos.col > 0 {
+		return editorPos{pos.row, previousBoundary(e.lines[pos.row], pos.col)}
+	}
+	if pos.row > 0 {
+		return editorPos{pos.row - 1, len(e.lines[pos.row-1])}
+	}
+	return pos
+}
+
+func (e textEditor) right(pos editorPos) editorPos {
+	line := e.lines[pos.row]
+	if pos.col < len(line) {
+		cluster, _, _, _ := uniseg.FirstGraphemeClusterInString(line[pos.col:], -1)
+		return editorPos{pos.row, pos.col + len(cluster)}
+	}
+	if pos.row < len(e.lines)-1 {
+		return editorPos{pos.row + 1, 0}
+	}
+	return pos
+}
+
+// wordLeft moves to the start of the word before pos, crossing line breaks
+func (e textEditor) wordLeft(pos editorPos) editorPos {
+	if pos.col == 0 {
+		return e.left(pos)
+	}
+	clusters := graphemesOf(e.lines[pos.row])
+	i := len(clusters) - 1
+	for i >= 0 && clusters[i].start >= pos.col {
+		i--
+	}
+	for i >= 0 && !isWordCluster(clusters[i].text) {
+		i--
+	}
+	for i >= 0 && isWordCluster(clusters[i].text) {
+		i--
+	}
+	if i < 0 {
+		return editorPos{pos.row, 0}
+	}
+	return editorPos{pos.row, clusters[i].end}
+}
+
+// wordRight moves to the end of the word after pos, crossing line breaks
+func (e textEditor) wordRight(pos editorPos) editorPos {
+	line := e.lines[pos.row]
+	if pos.col == len(line) {
+		return e.right(pos)
+	}
+	clusters := graphemesOf(line)
+	i := 0
+	for i < len(clusters) && clusters[i].start < pos.col {
+		i++
+	}
+	for i < len(clusters) && !isWordCluster(clusters[i].text) {
+		i++
+	}
+	for i < len(clusters) && isWordCluster(clusters[i].text) {
+		i++
+	}
+	if i == len(clusters) {
+		return editorPos{pos.row, len(line)}
+	}
+	return editorPos{pos.row, clusters[i].start}
+}
+
+// moveVertically moves the cursor by visual rows, so up and down step
+// through soft-wrapped lines, keeping to the column it started from
+func (e *textEditor) moveVertically(rows int, extend bool) {
+	visual := e.visualRows()
+	current := e.cursorVisualRow(visual)
+	if e.goalX < 0 {
+		r := visual[current]
+		e.goalX = textWidth(e.lines[r.row][r.start:e.cursor.col])
+	}
+
+	target := min(max(current+rows, 0), len(visual)-1)
+	if target == current {
+		return
+	}
+	r := visual[target]
+	line := e.lines[r.row]
+	col := r.start + columnForX(line[r.start:r.end], e.goalX)
+	if col == r.end && !r.last {
+		// The end of a wrapped row is the start of the next one
+		col = previousBoundary(line, col)
+	}
+
+	goalX := e.goalX
+	e.moveTo(editorPos{r.row, col}, extend)
+	e.goalX = goalX
+}
+
+// visualRow is one screen row of a soft-wrapped line
+type visualRow struct {
+	row        int
+	start, end int  // Byte range of the line shown on this row
+	last       bool // Whether this is the line's final row
+}
+
+func (e textEditor) visualRows() []visualRow {
+	var rows []visualRow
+	for i, line := range e.lines {
+		segments := wrapSegments(line, e.width)
+		for j, segment := range segments {
+			rows = append(rows, visualRow{i, segment[0], segment[1], j == len(segments)-1})
+		}
+	}
+	return rows
+}
+
+func (e textEditor) cursorVisualRow(rows []visualRow) int {
+	for i, r := range rows {
+		if r.row == e.cursor.row && e.cursor.col >= r.start && (e.cursor.col < r.end || r.last) {
+			return i
+		}
+	}
+	return 0
+}
+
+// ensureVisible scrolls just far enough to keep the cursor on screen
+func (e *textEditor) ensureVisible() {
+	current := e.cursorVisualRow(e.visualRows())
+	if current < e.scroll {
+		e.scroll = current
+	} else if current >= e.scroll+e.height {
+		e.scroll = current - e.height + 1
+	}
+}
+
+// View renders the visible rows with a gutter marking the cursor's line
+// (">" on its first row, "|" on wrapped ones), the cursor as a block and the
+// selection in reverse video
+func (e textEditor) View() string {
+	rows := e.visualRows()
+	current := e.cursorVisualRow(rows)
+	start, end, selecting := e.selection()
+	last := min(e.scroll+e.height, len(rows))
+
+	var b strings.Builder
+	if e.scroll > 0 {
+		b.WriteString("  ↑ (more above)\n")
+	}
+	for i := e.scroll; i < last; i++ {
+		r := rows[i]
+		gutter := " "
+		if r.row == e.cursor.row {
+			gutter = "|"
+			if r.start == 0 {
+				gutter = ">"
+			}
+		}
+		b.WriteString(gutter + " ")
+
+		line := e.lines[r.row]
+		for _, g := range graphemesOf(line[r.start:r.end]) {
+			pos := editorPos{r.row, r.start + g.start}
+			if i == current && pos.col == e.cursor.col {
+				b.WriteString("█")
+			}
+			text := displayCluster(g.text)
+			if selecting && !pos.before(start) && pos.before(end) {
+				text = selectionStyle.Render(text)
+			}
+			b.WriteString(text)
+		}
+		if i == current && e.cursor.col == r.end {
+			b.WriteString("█")
+		}
+		b.WriteString("\n")
+	}
+	if last < len(rows) {
+		b.WriteString("  ↓ (more below)\n")
+	}
+	return b.String()
+}
+
+// grapheme is one user-perceived character and where it sits in its string
+type grapheme struct {
+	text       string
+	start, end int
+	width      int
+}
+
+func graphemesOf(s string) []grapheme {
+	var clusters []grapheme
+	state := -1
+	offset := 0
+	for s != "" {
+		var cluster string
+		var width int
+		cluster, s, width, state = uniseg.FirstGraphemeClusterInString(s, state)
+		if cluster == "\t" {
+			width = tabWidth
+		}
+		clusters = append(clusters, grapheme{cluster, offset, offset + len(cluster), width})
+		offset += len(cluster)
+	}
+	return clusters
+}
+
+func previousBoundary(s string, col int) int {
+	previous := 0
+	for _, g := range graphemesOf(s[:col]) {
+		previous = g.start
+	}
+	return previous
+}
+
+func textWidth(s string) int {
+	width := 0
+	for _, g := range graphemesOf(s) {
+		width += g.width
+	}
+	return width
+}
+
+// columnForX returns the byte offset in s of the character at display
+// column x, or len(s) when s is narrower than that
+func columnForX(s string, x int) int {
+	width := 0
+	for _, g := range graphemesOf(s) {
+		if width+g.width > x {
+			return g.start
+		}
+		width += g.width
+	}
+	return len(s)
+}
+
+func isWordCluster(cluster string) bool {
+	r := []rune(cluster)[0]
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func displayCluster(cluster string) string {
+	if cluster == "\t" {
+		return strings.Repeat(" ", tabWidth)
+	}
+	return cluster
+}
+
+// wrapSegments splits a line into byte ranges no wider than width columns,
+// breaking after a space where possible. Spaces at a break stay on the
+// earlier row so that the ranges cover the line exactly.
+func wrapSegments(line string, width int) [][2]int {
+	if width <= 0 {
+		return [][2]int{{0, len(line)}}
+	}
+
+	var segments [][2]int
+	start, x, lastBreak := 0, 0, -1
+	for _, g := range graphemesOf(line) {
+		if g.text != " " && x+g.width > width && g.start > start {
+			end := g.start
+			if lastBreak > start {
+				end = lastBreak
+			}
+			segments = append(segments, [2]int{start, end})
+			start = end
+			x = textWidth(line[start:g.start])
+			lastBreak = -1
+		}
+		x += g.width
+		if g.text == " " {
+			lastBreak = g.end
+		}
+	}
+	return append(segments, [2]int{start, len(line)})
+}
+
+// maxUndo is how many edits a field's history remembers
+const maxUndo = 200
+
+type editKind int
+
+const (
+	editNone editKind = iota
+	editTyping
+	editDeleting
+	editOther // Pastes, newlines and word deletions, never coalesced
+)
+
+// editorState is a snapshot of the editor's text. Edits always build new
+// line slices, so snapshots can share them safely.
+type editorState struct {
+	lines  []string
+	cursor editorPos
+}
+
+// editHistory is the undo/redo history of one field. Consecutive typing or
+// deleting is coalesced into a single undo step until the cursor moves, a
+// word ends or a different kind of edit happens.
+type editHistory struct {
+	undoStack []editorState
+	redoStack []editorState
+	lastKind  editKind // Kind of the run still open on top of undoStack
+}
+
+func (h *editHistory) record(current editorState, kind editKind) {
+	if kind != editOther && kind == h.lastKind {
+		return
+	}
+	h.undoStack = append(h.undoStack, current)
+	if len(h.undoStack) > maxUndo {
+		h.undoStack = h.undoStack[1:]
+	}
+	h.redoStack = nil
+	h.lastKind = kind
+}
+
+// seal ends the current run, so the next edit gets its own undo step
+func (h *editHistory) seal() {
+	h.lastKind = editNone
+}
+
+func (h *editHistory) undo(current editorState) (editorState, bool) {
+	if len(h.undoStack) == 0 {
+		return current, false
+	}
+	state := h.undoStack[len(h.undoStack)-1]
+	h.undoStack = h.undoStack[:len(h.undoStack)-1]
+	h.redoStack = append(h.redoStack, current)
+	h.seal()
+	return state, true
+}
+
+func (h *editHistory) redo(current editorState) (editorState, bool) {
+	if len(h.redoStack) == 0 {
+		return current, false
+	}
+	state := h.redoStack[len(h.redoStack)-1]
+	h.redoStack = h.redoStack[:len(h.redoStack)-1]
+	h.undoStack = append(h.undoStack, current)
+	h.seal()
+	return state, true
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func press(e *textEditor, keys ...tea.KeyType) {
+	for _, key := range keys {
+		e.HandleKey(tea.KeyMsg{Type: key})
+	}
+}
+
+// typeText types s a character at a time, as the terminal sends it
+func typeText(e *textEditor, s string) {
+	for _, r := range s {
+		if r == ' ' {
+			e.HandleKey(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{r}})
+		} else {
+			e.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+}
+
+func TestEditorMovesByGraphemeCluster(t *testing.T) {
+	// Curly quotes as gcc prints them, and a thumbs up with a skin tone
+	// modifier, which is two code points but one character
+	const thumbs = "\U0001F44D\U0001F3FD"
+	e := newTextEditor("‘x’ " + thumbs + "!")
+
+	var stops []int
+	for {
+		stops = append(stops, e.cursor.col)
+		before := e.cursor
+		press(&e, tea.KeyRight)
+		if e.cursor == before {
+			break
+		}
+	}
+	want := []int{0, 3, 4, 7, 8, 16, 17}
+	if !slices.Equal(stops, want) {
+		t.Fatalf("right stopped at %v, want %v", stops, want)
+	}
+
+	press(&e, tea.KeyLeft)
+	if e.cursor.col != 16 {
+		t.Fatalf("left from the end went to %d, want 16", e.cursor.col)
+	}
+	press(&e, tea.KeyLeft)
+	if e.cursor.col != 8 {
+		t.Fatalf("left over the emoji went to %d, want 8", e.cursor.col)
+	}
+
+	press(&e, tea.KeyRight, tea.KeyBackspace)
+	if got := e.Value(); got != "‘x’ !" {
+		t.Errorf("backspace after the emoji left %q, want the whole emoji gone", got)
+	}
+	press(&e, tea.KeyLeft, tea.KeyBackspace)
+	if got := e.Value(); got != "‘x !" {
+		t.Errorf("backspace after the closing quote left %q", got)
+	}
+	press(&e, tea.KeyHome, tea.KeyDelete)
+	if got := e.Value(); got != "x !" {
+		t.Errorf("delete on the opening quote left %q", got)
+	}
+}
+
+func TestEditorWordMotions(t *testing.T) {
+	e := newTextEditor("undefined reference to `foo_bar'\n  next_line")
+
+	var rights []editorPos
+	for pos := (editorPos{}); ; {
+		next := e.wordRight(pos)
+		if next == pos {
+			break
+		}
+		rights = append(rights, next)
+		pos = next
+	}
+	wantRights := []editorPos{{0, 9}, {0, 19}, {0, 22}, {0, 31}, {0, 32}, {1, 0}, {1, 11}}
+	if !slices.Equal(rights, wantRights) {
+		t.Errorf("wordRight stopped at %v, want %v", rights, wantRights)
+	}
+
+	var lefts []editorPos
+	for pos := (editorPos{1, 11}); ; {
+		next := e.wordLeft(pos)
+		if next == pos {
+			break
+		}
+		lefts = append(lefts, next)
+		pos = next
+	}
+	wantLefts := []editorPos{{1, 2}, {1, 0}, {0, 32}, {0, 24}, {0, 20}, {0, 10}, {0, 0}}
+	if !slices.Equal(lefts, wantLefts) {
+		t.Errorf("wordLeft stopped at %v, want %v", lefts, wantLefts)
+	}
+}
+
+func TestEditorSelectedTextAcrossLines(t *testing.T) {
+	e := newTextEditor("first line\nsecond\nthird line")
+
+	e.moveTo(editorPos{0, 6}, false)
+	press(&e, tea.KeyShiftDown, tea.KeyShiftDown, tea.KeyShiftEnd)
+	if got, want := e.SelectedText(), "line\nsecond\nthird line"; got != want {
+		t.Errorf("selected %q, want %q", got, want)
+	}
+
+	// Selecting backwards gives the same text in document order
+	e.moveTo(editorPos{2, 5}, false)
+	press(&e, tea.KeyShiftUp, tea.KeyShiftUp)
+	if got, want := e.SelectedText(), " line\nsecond\nthird"; got != want {
+		t.Errorf("selected backwards %q, want %q", got, want)
+	}
+
+	typeText(&e, "X")
+	if got, want := e.Value(), "firstX line"; got != want {
+		t.Errorf("typing over the selection gave %q, want %q", got, want)
+	}
+	if e.SelectedText() != "" {
+		t.Error("typing should clear the selection")
+	}
+}
+
+func TestWrapSegments(t *testing.T) {
+	tests := []struct {
+		line  string
+		width int
+		want  [][2]int
+	}{
+		{"hello world foo", 6, [][2]int{{0, 6}, {6, 12}, {12, 15}}},
+		{"abcdefghij", 4, [][2]int{{0, 4}, {4, 8}, {8, 10}}},
+		// Wide characters take two columns each
+		{"日本語です", 4, [][2]int{{0, 6}, {6, 12}, {12, 15}}},
+		{"", 10, [][2]int{{0, 0}}},
+		{"short", 0, [][2]int{{0, 5}}},
+	}
+	for _, test := range tests {
+		got := wrapSegments(test.line, test.width)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("wrapSegments(%q, %d) = %v, want %v", test.line, test.width, got, test.want)
+		}
+		// The segments always cover the line exactly
+		if got[0][0] != 0 || got[len(got)-1][1] != len(test.line) {
+			t.Errorf("wrapSegments(%q, %d) doesn't cover the line", test.line, test.width)
+		}
+	}
+}
+
+func TestEditorMovesThroughSoftWrappedLines(t *testing.T) {
+	e := newTextEditor("aaaa bbbb cccc dd\nxy")
+	e.SetSize(10, 5)
+	// Wrapped as "aaaa bbbb " / "cccc dd", then "xy"
+
+	e.moveTo(editorPos{0, 7}, false)
+	press(&e, tea.KeyDown)
+	if want := (editorPos{0, 17}); e.cursor != want {
+		t.Fatalf("down from column 7 went to %v, want %v (the end of the shorter wrapped row)", e.cursor, want)
+	}
+	press(&e, tea.KeyDown)
+	if want := (editorPos{1, 2}); e.cursor != want {
+		t.Fatalf("down onto the next line went to %v, want %v", e.cursor, want)
+	}
+	// The column from before is remembered across short rows
+	press(&e, tea.KeyUp, tea.KeyUp)
+	if want := (editorPos{0, 7}); e.cursor != want {
+		t.Fatalf("back up went to %v, want %v", e.cursor, want)
+	}
+
+	// The end of a wrapped row is shown at the start of the next one, so
+	// moving onto it lands before the wrap instead
+	e.SetText("aaaa bbbb cccccccccc")
+	e.moveTo(editorPos{0, 20}, false)
+	press(&e, tea.KeyUp)
+	if want := (editorPos{0, 9}); e.cursor != want {
+		t.Errorf("up to the wrapped row went to %v, want %v", e.cursor, want)
+	}
+}
+
+func TestEditorUndoCoalescesTyping(t *testing.T) {
+	e := newTextEditor("")
+	typeText(&e, "foo bar")
+
+	press(&e, tea.KeyCtrlZ)
+	if got := e.Value(); got != "foo " {
+		t.Fatalf("first undo gave %q, want the last word undone", got)
+	}
+	press(&e, tea.KeyCtrlZ)
+	if got := e.Value(); got != "" {
+		t.Fatalf("second undo gave %q, want everything undone", got)
+	}
+	press(&e, tea.KeyCtrlY, tea.KeyCtrlY)
+	if got := e.Value(); got != "foo bar" {
+		t.Fatalf("redo gave %q", got)
+	}
+
+	// A run of backspaces is one step, and moving the cursor ends a run
+	press(&e, tea.KeyBackspace, tea.KeyBackspace, tea.KeyLeft, tea.KeyBackspace)
+	if got := e.Value(); got != "foob" {
+		t.Fatalf("deleting gave %q", got)
+	}
+	press(&e, tea.KeyCtrlZ)
+	if got := e.Value(); got != "foo b" {
+		t.Fatalf("undo after moving gave %q, want only the last backspace undone", got)
+	}
+	press(&e, tea.KeyCtrlZ)
+	if got := e.Value(); got != "foo bar" {
+		t.Fatalf("undo of the backspace run gave %q", got)
+	}
+
+	// A new edit drops what could have been redone
+	typeText(&e, "!")
+	press(&e, tea.KeyCtrlY)
+	if got := e.Value(); got != "foo bar!" {
+		t.Errorf("redo after a new edit gave %q, want nothing redone", got)
+	}
+}
+
+func TestEditHistoryKinds(t *testing.T) {
+	var h editHistory
+	state := func(text string) editorState { return editorState{lines: []string{text}} }
+
+	h.record(state(""), editTyping)
+	h.record(state("a"), editTyping)
+	h.record(state("ab"), editDeleting)
+	h.record(state("a"), editOther)
+	h.record(state("a\n"), editOther)
+	if got := len(h.undoStack); got != 4 {
+		t.Errorf("%d undo steps, want 4: typing coalesces, a change of kind and every other edit don't", got)
+	}
+
+	for i := 0; i < maxUndo+10; i++ {
+		h.record(state(""), editOther)
+	}
+	if got := len(h.undoStack); got != maxUndo {
+		t.Errorf("history holds %d steps, want at most %d", got, maxUndo)
+	}
+}
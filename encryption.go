@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Encrypted fields are stored as goofenc:v1:<key ID>:<base64 nonce+ciphertext>,
+// sealed with AES-256-GCM under a key kept on the user's machine. The key ID
+// says which key sealed a value, without revealing anything about the key.
+const encryptedPrefix = "goofenc:v1:"
+
+// lockedSolution stands in for a solution that can't be decrypted here. It's
+// shown instead of the ciphertext, and saving it keeps the stored ciphertext.
+const lockedSolution = "[Encrypted solution: no key to decrypt it on this machine]"
+
+// encryptionKeySize is the key size for AES-256
+const encryptionKeySize = 32
+
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// encryptionKeyID is a short, non-secret name for a key
+func encryptionKeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("goof key id\x00"), key...))
+	return hex.EncodeToString(sum[:4])
+}
+
+// encryptField seals value, binding it to the field's name so a ciphertext
+// can't be moved into another field
+func encryptField(field, value string, key []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(field))
+	return encryptedPrefix + encryptionKeyID(key) + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptField opens a value sealed by encryptField
+func decryptField(field, value string, key []byte) (string, error) {
+	keyID, payload, ok := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted value")
+	}
+	if keyID != encryptionKeyID(key) {
+		return "", fmt.Errorf("encrypted with another key (%s)", keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("bad encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// defaultEncryptionKeyPath is encryption.key next to the config file
+func defaultEncryptionKeyPath() string {
+	return filepath.Join(filepath.Dir(configFilePath()), "encryption.key")
+}
+
+// loadEncryptionKey reads a key file written by `goof keygen`. A missing file
+// means encryption is off, so it's not an error.
+func loadEncryptionKey(path string) (Secret, error) {
+	encoded, err := readKeyFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != encryptionKeySize {
+		return "", fmt.Errorf("%s doesn't hold a %d-byte base64 key", path, encryptionKeySize)
+	}
+	return Secret(key), nil
+}
+
+// encryptReport seals the report's solution when there's a key. Solutions
+// stay out of search once encrypted; the symptom and other searchable fields
+// are left in plaintext, and so are the resources, which -resource filters on
+// by exact value. Those are redacted instead, see redactReport.
+func encryptReport(report ErrorReport, key Secret) (ErrorReport, error) {
+	if key == "" || report.Solution == "" || isEncrypted(report.Solution) {
+		return report, nil
+	}
+	sealed, err := encryptField("solution", report.Solution, []byte(key.Reveal()))
+	if err != nil {
+		return report, fmt.Errorf("failed to encrypt solution: %w", err)
+	}
+	report.Solution = sealed
+	return report, nil
+}
+
+// decryptReports opens encrypted solutions, replacing those that can't be
+// opened here with lockedSolution
+func decryptReports(reports []ErrorReport, key Secret) {
+	for i := range reports {
+		reports[i] = decryptReport(reports[i], key)
+	}
+}
+
+func decryptReport(report ErrorReport, key Secret) ErrorReport {
+	if !isEncrypted(report.Solution) {
+		return report
+	}
+	if key == "" {
+		report.Solution = lockedSolution
+		return report
+	}
+	plain, err := decryptField("solution", report.Solution, []byte(key.Reveal()))
+	if err != nil {
+		slog.Warn("Failed to decrypt solution", "report_id", report.ID, "err", err)
+		report.Solution = lockedSolution
+		return report
+	}
+	report.Solution = plain
+	return report
+}
+
+func runKeygenCommand(args []string) int {
+	fs := newFlagSet("keygen")
+	path := fs.String("o", "", "Where to write the key (default the profile's encryption_key_file)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return parseExitCode(err)
+	}
+	if *path == "" {
+		*path = LoadConfig().EncryptionKeyFile
+	}
+
+	if _, err := os.Stat(*path); err == nil {
+		fmt.Fprintf(os.Stderr, "goof keygen: %s already exists; solutions encrypted with it would be lost if it were replaced\n", *path)
+		return exitError
+	}
+	key := make([]byte, encryptionKeySize)
+	if _, err := rand.Read(key); err != nil {
+		fmt.Fprintf(os.Stderr, "goof keygen: %v\n", err)
+		return exitError
+	}
+	if err := os.MkdirAll(filepath.Dir(*path), 0o700); err != nil {
+		fmt.Fprintf(os.Stderr, "goof keygen: %v\n", err)
+		return exitError
+	}
+	encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+	if err := os.WriteFile(*path, []byte(encoded), 0o600); err != nil {
+		fmt.Fprintf(os.Stderr, "goof keygen: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("Wrote encryption key %s to %s\n", encryptionKeyID(key), *path)
+	fmt.Println("Solutions saved from now on are encrypted. Share the file securely with everyone who should read them, and back it up.")
+	return exitOK
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useFileStore points goof at a report file in a temporary directory, with an
+// encryption key when withKey is set
+func useFileStore(t *testing.T, withKey bool) fileStore {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("GOOF_CONFIG", filepath.Join(dir, "config.toml"))
+	t.Setenv("GOOF_BACKEND", backendFile)
+	t.Setenv("GOOF_STORE_PATH", filepath.Join(dir, "reports.json"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	t.Setenv("MEILISEARCH_KEY", "unused")
+	forgetResolvedKeys()
+	t.Cleanup(forgetResolvedKeys)
+
+	keyPath := filepath.Join(dir, "encryption.key")
+	t.Setenv("GOOF_ENCRYPTION_KEY_FILE", keyPath)
+	if withKey {
+		key := make([]byte, encryptionKeySize)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString(key)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fileStore{filepath.Join(dir, "reports.json")}
+}
+
+func TestSaveRedactsOrEncryptsSolution(t *testing.T) {
+	report := ErrorReport{
+		Symptom:   "fatal: unable to access 'https://git.corp/tools.git/': Could not resolve host: git.corp",
+		Program:   "git",
+		Resources: []string{"https://wiki.corp/Build_Mirrors"},
+		Solution:  "Use the mirror at build-cache.internal:8080 with password=hunter22",
+	}
+
+	for _, withKey := range []bool{false, true} {
+		name := "without key"
+		if withKey {
+			name = "with key"
+		}
+		t.Run(name, func(t *testing.T) {
+			store := useFileStore(t, withKey)
+
+			id, err := SaveErrorReport(report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored, err := store.Get(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Resources stay in plaintext for -resource to filter on, so
+			// they're always redacted
+			if strings.Contains(stored.Symptom, ".corp") || strings.Contains(strings.Join(stored.Resources, " "), ".corp") {
+				t.Errorf("symptom or resources weren't redacted: %q, %q", stored.Symptom, stored.Resources)
+			}
+			if strings.Contains(stored.Solution, "hunter22") || strings.Contains(stored.Solution, "build-cache") {
+				t.Errorf("solution is stored in plaintext: %q", stored.Solution)
+			}
+			if isEncrypted(stored.Solution) != withKey {
+				t.Errorf("solution stored as %q, encrypted should be %v", stored.Solution, withKey)
+			}
+
+			// With a key, the solution is encrypted rather than redacted, so
+			// those who have the key get all of it back
+			read, err := GetErrorReport(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if withKey && read.Solution != report.Solution {
+				t.Errorf("decrypted solution %q, want %q", read.Solution, report.Solution)
+			}
+
+			preview := previewRedactions(report, LoadConfig())
+			for _, finding := range preview {
+				if finding.Field == "Solution" && withKey {
+					t.Errorf("preview says the solution will be redacted: %+v", finding)
+				}
+			}
+		})
+	}
+}
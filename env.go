@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// environmentVariables are the env vars that commonly change how a build or
+// program behaves, so they are recorded alongside each report
+var environmentVariables = []string{
+	"CC",
+	"CXX",
+	"CFLAGS",
+	"CXXFLAGS",
+	"CPPFLAGS",
+	"LDFLAGS",
+	"LD_LIBRARY_PATH",
+	"PKG_CONFIG_PATH",
+}
+
+var (
+	currentEnvironmentOnce sync.Once
+	currentEnvironment     map[string]string
+)
+
+// CurrentEnvironment fingerprints the machine goof is running on. It runs the
+// compiler to find the toolchain, so it is only computed once per run; callers
+// get their own copy to fill into reports.
+func CurrentEnvironment() map[string]string {
+	currentEnvironmentOnce.Do(func() {
+		currentEnvironment = detectEnvironment()
+	})
+	return maps.Clone(currentEnvironment)
+}
+
+func detectEnvironment() map[string]string {
+	env := map[string]string{
+		"os":   runtime.GOOS,
+		"arch": unameArch(runtime.GOARCH),
+	}
+
+	if toolchain := detectToolchain(); toolchain != "" {
+		env["toolchain"] = toolchain
+	}
+	if container, image := detectContainer(); container != "" {
+		env["container"] = container
+		if image != "" {
+			env["container_image"] = image
+		}
+	}
+	if locale := detectLocale(); locale != "" {
+		env["locale"] = locale
+	}
+
+	for _, name := range environmentVariables {
+		if value := os.Getenv(name); value != "" {
+			env[name] = value
+		}
+	}
+
+	return env
+}
+
+// unameArch maps Go's architecture names to the ones `uname -m` prints,
+// since that is what people paste into error reports
+func unameArch(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i686"
+	case "arm64":
+		return "aarch64"
+	}
+	return goarch
+}
+
+// detectToolchain returns the first line of `$CC --version`
+func detectToolchain() string {
+	compiler := os.Getenv("CC")
+	if compiler == "" {
+		compiler = "cc"
+	}
+
+	out, err := exec.Command(compiler, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(getFirstLine(string(out)))
+}
+
+// detectContainer reports the container runtime and image, if any
+func detectContainer() (string, string) {
+	if data, err := os.ReadFile("/run/.containerenv"); err == nil {
+		image := ""
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "image=") {
+				image = strings.Trim(strings.TrimPrefix(line, "image="), "\"")
+			}
+		}
+		return "podman", image
+	}
+
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return "docker", os.Getenv("CONTAINER_IMAGE")
+	}
+
+	if container := os.Getenv("container"); container != "" {
+		return container, os.Getenv("CONTAINER_IMAGE")
+	}
+
+	return "", ""
+}
+
+func detectLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// environmentMatchScore counts the keys on which two environments agree
+func environmentMatchScore(env, current map[string]string) int {
+	score := 0
+	for key, value := range current {
+		if env[key] == value {
+			score++
+		}
+	}
+	return score
+}
+
+// environmentBoost is how much a report recorded on an identical machine
+// gains over its relevance, which the stores score from 0 to 1. It is small
+// so that a similar machine only reorders reports that are about as relevant.
+const environmentBoost = 0.05
+
+// rankByEnvironment nudges reports recorded on a similar machine ahead of
+// about equally relevant ones, keeping the search engine's order otherwise
+func rankByEnvironment(reports []ErrorReport, current map[string]string) {
+	if len(current) == 0 {
+		return
+	}
+	rank := func(report ErrorReport) float64 {
+		match := float64(environmentMatchScore(report.Environment, current)) / float64(len(current))
+		return report.Relevance + environmentBoost*match
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return rank(reports[i]) > rank(reports[j])
+	})
+}
+
+// environmentKeyPattern matches the environment keys goof can filter on. The
+// key becomes part of a Meilisearch filter expression, where it can't be
+// quoted.
+var environmentKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+func validateEnvironmentKey(key string) error {
+	if !environmentKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid environment key %q: only letters, digits and _ are allowed", key)
+	}
+	return nil
+}
+
+// formatEnvironment renders an environment as "key=value" lines
+func formatEnvironment(env map[string]string, sep string) string {
+	pairs := make([]string, 0, len(env))
+	for _, key := range sortedKeys(env) {
+		pairs = append(pairs, key+"="+env[key])
+	}
+	return strings.Join(pairs, sep)
+}
+
+// parseEnvironment parses "key=value" lines, skipping blank or malformed ones
+func parseEnvironment(text string) map[string]string {
+	env := map[string]string{}
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		env[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return env
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func TestCurrentEnvironmentIsCopied(t *testing.T) {
+	env := CurrentEnvironment()
+	env["arch"] = "edited"
+	env["extra"] = "x"
+
+	again := CurrentEnvironment()
+	if again["arch"] == "edited" || again["extra"] != "" {
+		t.Errorf("editing a report's environment changed the cached one: %v", again)
+	}
+}
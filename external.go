@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"gopkg.in/yaml.v3"
+)
+
+// externalEditTarget says what an external edit replaces when it returns
+type externalEditTarget int
+
+const (
+	externalEditField  externalEditTarget = iota // The selected field in the form
+	externalEditEditor                           // The text in the field editor
+	externalEditReport                           // The whole report, as a Markdown document
+)
+
+// externalEditMsg carries the text back from $EDITOR
+type externalEditMsg struct {
+	target externalEditTarget
+	text   string
+	err    error
+}
+
+// editorCommand is the user's editor, from the config, $VISUAL or $EDITOR. It
+// may carry arguments of its own, e.g. "code --wait".
+func editorCommand() []string {
+	if fields := strings.Fields(LoadConfig().Editor); len(fields) > 0 {
+		return fields
+	}
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(name)); len(fields) > 0 {
+			return fields
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// editExternally suspends the TUI, opens text in the user's editor through a
+// temp file and delivers the saved result as an externalEditMsg
+func editExternally(target externalEditTarget, text, suffix string) tea.Cmd {
+	file, err := os.CreateTemp("", "goof-*"+suffix)
+	if err != nil {
+		return func() tea.Msg {
+			return externalEditMsg{target: target, err: fmt.Errorf("failed to create temp file: %w", err)}
+		}
+	}
+	path := file.Name()
+	_, err = file.WriteString(text)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return func() tea.Msg {
+			return externalEditMsg{target: target, err: fmt.Errorf("failed to write temp file: %w", err)}
+		}
+	}
+
+	argv := append(editorCommand(), path)
+	cmd := exec.Command(argv[0], argv[1:]...)
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		defer os.Remove(path)
+		if err != nil {
+			return externalEditMsg{target: target, err: fmt.Errorf("failed to run %s: %w", argv[0], err)}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return externalEditMsg{target: target, err: fmt.Errorf("failed to read edited file: %w", err)}
+		}
+		// Editors add a final newline the field never had
+		return externalEditMsg{target: target, text: strings.TrimSuffix(string(data), "\n")}
+	})
+}
+
+// reportFrontMatter is the part of a report edited as YAML front matter
+type reportFrontMatter struct {
+	Program        string            `yaml:"program"`
+	ProgramVersion string            `yaml:"program_version"`
+	Distro         string            `yaml:"distro"`
+	DistroVersion  string            `yaml:"distro_version"`
+	Team           string            `yaml:"team"`
+	Resources      []string          `yaml:"resources"`
+	Environment    map[string]string `yaml:"environment"`
+}
+
+const (
+	frontMatterDelimiter = "---"
+	symptomHeading       = "## Symptom"
+	solutionHeading      = "## Solution"
+)
+
+var (
+	codeFencePattern = regexp.MustCompile("^`{3,}")
+	backtickRun      = regexp.MustCompile("`+")
+)
+
+// codeFence returns a fence that can't be closed by anything in text
+func codeFence(text string) string {
+	longest := 2
+	for _, run := range backtickRun.FindAllString(text, -1) {
+		longest = max(longest, len(run))
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// reportToMarkdown renders a report as one document: the short fields as
+// YAML front matter, then the symptom as a code block and the solution as Markdown
+func reportToMarkdown(report ErrorReport) (string, error) {
+	frontMatter, err := yaml.Marshal(reportFrontMatter{
+		Program:        report.Program,
+		ProgramVersion: report.ProgramVersion,
+		Distro:         report.Distro,
+		DistroVersion:  report.DistroVersion,
+		Team:           report.Team,
+		Resources:      report.Resources,
+		Environment:    report.Environment,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode front matter: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString(frontMatterDelimiter + "\n")
+	b.Write(frontMatter)
+	b.WriteString(frontMatterDelimiter + "\n\n")
+	fence := codeFence(report.Symptom)
+	b.WriteString(symptomHeading + "\n\n" + fence + "text\n" + report.Symptom + "\n" + fence + "\n\n")
+	b.WriteString(solutionHeading + "\n\n" + report.Solution + "\n")
+	return b.String(), nil
+}
+
+// applyMarkdownReport parses a document written by reportToMarkdown back into
+// report, leaving the fields it doesn't cover (ID, date) alone
+func applyMarkdownReport(report ErrorReport, document string) (ErrorReport, error) {
+	document = strings.ReplaceAll(document, "\r\n", "\n")
+	rest, ok := strings.CutPrefix(document, frontMatterDelimiter+"\n")
+	if !ok {
+		return report, fmt.Errorf("document must start with %q front matter", frontMatterDelimiter)
+	}
+	frontMatter, body, ok := strings.Cut("\n"+rest, "\n"+frontMatterDelimiter+"\n")
+	if !ok {
+		return report, fmt.Errorf("front matter is not closed with %q", frontMatterDelimiter)
+	}
+
+	var fields reportFrontMatter
+	decoder := yaml.NewDecoder(bytes.NewReader([]byte(frontMatter)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fields); err != nil && !errors.Is(err, io.EOF) {
+		return report, fmt.Errorf("failed to parse front matter: %w", err)
+	}
+
+	// The symptom sits in a code block whose fence is longer than any run of
+	// backticks inside it, so it can hold anything, Markdown included
+	_, body, ok = strings.Cut("\n"+body, "\n"+symptomHeading+"\n")
+	if !ok {
+		return report, fmt.Errorf("missing %q section", symptomHeading)
+	}
+	body = strings.TrimLeft(body, "\n")
+	fence := codeFencePattern.FindString(body)
+	if fence == "" {
+		return report, fmt.Errorf("the symptom must be a fenced code block")
+	}
+	_, body, _ = strings.Cut(body, "\n")
+	symptom, body, ok := strings.Cut("\n"+body, "\n"+fence+"\n")
+	if !ok {
+		return report, fmt.Errorf("the symptom's code block is not closed with %s", fence)
+	}
+	_, solution, ok := strings.Cut("\n"+body, "\n"+solutionHeading+"\n")
+	if !ok {
+		return report, fmt.Errorf("missing %q section", solutionHeading)
+	}
+
+	report.Program = fields.Program
+	report.ProgramVersion = fields.ProgramVersion
+	report.Distro = fields.Distro
+	report.DistroVersion = fields.DistroVersion
+	report.Team = fields.Team
+	report.Resources = fields.Resources
+	if report.Resources == nil {
+		report.Resources = []string{}
+	}
+	report.Environment = fields.Environment
+	report.Symptom = strings.TrimPrefix(symptom, "\n")
+	report.Solution = strings.Trim(solution, "\n")
+	return report, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// fileStore keeps reports in a local JSON file, for the offline profile. It
+// holds the same documents as Meilisearch and searches them in memory.
+type fileStore struct {
+	path string
+}
+
+// fileSearchFields are the text fields searched, with how much a match in
+// each counts, mirroring the searchable attribute order in Meilisearch
+var fileSearchFields = []struct {
+	field  string
+	weight int
+}{
+	{"headline", 7},
+	{"symptom", 6},
+	{"program", 5},
+	{"program_version", 4},
+	{"distro", 3},
+	{"distro_version", 2},
+	{"solution", 1},
+}
+
+func (s fileStore) load() ([]map[string]interface{}, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+
+	var documents []map[string]interface{}
+	if err := json.Unmarshal(data, &documents); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	return documents, nil
+}
+
+// save writes the documents to a temp file first so a crash can't leave the
+// store half written
+func (s fileStore) save(documents []map[string]interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(documents, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s fileStore) Search(filter Filter) ([]ErrorReport, error) {
+	documents, err := s.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+
+	programAliases := programFilterAliases(filter.Program)
+	var words []string
+	for _, part := range []string{filter.Q, filter.Symptom, filter.ProgramVersion, filter.Distro, filter.DistroVersion, filter.Solution} {
+		words = append(words, strings.Fields(strings.ToLower(part))...)
+	}
+	if filter.Program != "" && len(programAliases) == 0 {
+		words = append(words, strings.ToLower(filter.Program))
+	}
+
+	type scored struct {
+		report ErrorReport
+		score  int
+	}
+	var matches []scored
+	for _, document := range documents {
+		report := reportFromHit(document)
+		if !fileFilterMatches(report, filter, programAliases) {
+			continue
+		}
+
+		// Like Meilisearch, rank by how many query words match and where
+		score := 0
+		for _, word := range words {
+			for _, f := range fileSearchFields {
+				if strings.Contains(strings.ToLower(getString(document, f.field)), word) {
+					score += f.weight
+					break
+				}
+			}
+		}
+		if len(words) > 0 && score == 0 {
+			continue
+		}
+		matches = append(matches, scored{report, score})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].report.Date.After(matches[j].report.Date)
+	})
+	reports := make([]ErrorReport, 0, min(len(matches), 100))
+	for i := 0; i < len(matches) && i < 100; i++ {
+		// Scale the score to 0-1 like Meilisearch's ranking score
+		report := matches[i].report
+		report.Relevance = 1
+		if top := matches[0].score; top > 0 {
+			report.Relevance = float64(matches[i].score) / float64(top)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// fileFilterMatches applies the filters Meilisearch would apply as filter
+// expressions
+func fileFilterMatches(report ErrorReport, filter Filter, programAliases []string) bool {
+	if filter.DateFrom != nil && report.Date.Before(*filter.DateFrom) {
+		return false
+	}
+	if filter.DateTo != nil && report.Date.After(*filter.DateTo) {
+		return false
+	}
+	if len(filter.ResourcesAny) > 0 && !slices.ContainsFunc(filter.ResourcesAny, func(resource string) bool {
+		return slices.Contains(report.Resources, resource)
+	}) {
+		return false
+	}
+	if len(programAliases) > 0 && !matchesProgramAliases(report.Program, programAliases) {
+		return false
+	}
+	if filter.Fingerprint != "" && report.Fingerprint != filter.Fingerprint {
+		return false
+	}
+	if filter.Team != "" && report.Team != filter.Team {
+		return false
+	}
+	for key, value := range filter.Extracted {
+		if !slices.Contains(report.Extracted[key], value) {
+			return false
+		}
+	}
+	for key, value := range filter.Environment {
+		if report.Environment[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (s fileStore) Get(id string) (ErrorReport, error) {
+	documents, err := s.load()
+	if err != nil {
+		return ErrorReport{}, fmt.Errorf("failed to get error report: %w", err)
+	}
+	for _, document := range documents {
+		if getString(document, "id") == id {
+			return reportFromHit(document), nil
+		}
+	}
+	return ErrorReport{}, fmt.Errorf("%w: %s", ErrReportNotFound, id)
+}
+
+func (s fileStore) All() ([]ErrorReport, error) {
+	documents, err := s.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list error reports: %w", err)
+	}
+	reports := make([]ErrorReport, 0, len(documents))
+	for _, document := range documents {
+		reports = append(reports, reportFromHit(document))
+	}
+	return reports, nil
+}
+
+func (s fileStore) Put(document map[string]interface{}) error {
+	documents, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	// Round-trip through JSON so the document looks as it will when loaded,
+	// e.g. with numbers as float64
+	data, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	var stored map[string]interface{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	id := getString(stored, "id")
+	replaced := false
+	for i, existing := range documents {
+		if getString(existing, "id") == id {
+			documents[i] = stored
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		documents = append(documents, stored)
+	}
+	return s.save(documents)
+}
+
+func (s fileStore) Delete(id string) error {
+	documents, err := s.load()
+	if err != nil {
+		return fmt.Errorf("failed to delete error report: %w", err)
+	}
+	kept := slices.DeleteFunc(documents, func(document map[string]interface{}) bool {
+		return getString(document, "id") == id
+	})
+	if err := s.save(kept); err != nil {
+		return fmt.Errorf("failed to delete error report: %w", err)
+	}
+	return nil
+}
+
+func (s fileStore) NeedsInitialization() (bool, error) {
+	_, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	return false, err
+}
+
+func (s fileStore) Initialize() error {
+	if _, err := os.Stat(s.path); err == nil {
+		return nil
+	}
+	if err := s.save([]map[string]interface{}{}); err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.path, err)
+	}
+	return nil
+}
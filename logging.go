@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	logMaxSize    = 5 << 20 // Bytes a log file may reach before it's rotated
+	logMaxBackups = 3       // Rotated files kept, as errors.log.1 to errors.log.3
+)
+
+// levelOff is above every level slog uses, so nothing gets logged
+const levelOff = slog.Level(100)
+
+// parseLogLevel accepts debug, info, warn, error or off
+func parseLogLevel(name string) (slog.Level, error) {
+	if strings.EqualFold(name, "off") {
+		return levelOff, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn, error or off)", name)
+	}
+	return level, nil
+}
+
+// initLogging sends slog's default logger to path at the given level, as text
+// or JSON, with secrets redacted. At level off nothing is written and the
+// file isn't created.
+func initLogging(level, format, path string) error {
+	minLevel, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	if minLevel == levelOff {
+		slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: levelOff})))
+		return nil
+	}
+
+	out := &rotatingFile{path: path, maxSize: logMaxSize, backups: logMaxBackups}
+	options := &slog.HandlerOptions{Level: minLevel}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(out, options)
+	case "json":
+		handler = slog.NewJSONHandler(out, options)
+	default:
+		return fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+	slog.SetDefault(slog.New(redactingHandler{handler}))
+	return nil
+}
+
+// redactingHandler scrubs secrets from the message and every attribute before
+// passing records on, so a key can't reach the log however it's logged
+type redactingHandler struct {
+	next slog.Handler
+}
+
+func (h redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redactedRecord := slog.NewRecord(record.Time, record.Level, redactSecrets(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redactedRecord.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redactedRecord)
+}
+
+func (h redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redactedAttrs[i] = redactAttr(attr)
+	}
+	return redactingHandler{h.next.WithAttrs(redactedAttrs)}
+}
+
+func (h redactingHandler) WithGroup(name string) slog.Handler {
+	return redactingHandler{h.next.WithGroup(name)}
+}
+
+func redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, redactSecrets(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redactedGroup := make([]any, len(group))
+		for i, member := range group {
+			redactedGroup[i] = redactAttr(member)
+		}
+		return slog.Group(attr.Key, redactedGroup...)
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case Secret:
+			return slog.String(attr.Key, v.String())
+		case error:
+			return slog.String(attr.Key, redactSecrets(v.Error()))
+		default:
+			return slog.String(attr.Key, redactSecrets(fmt.Sprintf("%+v", v)))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// rotatingFile appends to a log file, moving it aside once it grows past
+// maxSize. The file is opened on the first write.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate shifts errors.log.1 to errors.log.2 and so on, dropping the oldest,
+// then starts a fresh file
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+	for i := f.backups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	if f.backups > 0 {
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	return f.open()
+}
@@ -1,11 +1,11 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
-	"os/exec"
-	"runtime"
 	"strings"
 	"time"
 
@@ -46,7 +46,9 @@ const (
 	entryStepProgramVersion
 	entryStepDistro
 	entryStepDistroVersion
+	entryStepTeam
 	entryStepResources
+	entryStepEnvironment
 	entryStepSolution
 	entryStepConfirm
 )
@@ -73,6 +75,8 @@ type model struct {
 	// Entry state
 	entryStep     entryStep
 	currentReport ErrorReport
+	similarity    *similarityIndex // Local index of existing reports, nil until loaded
+	related       []relatedReport  // Reports similar to the symptom being entered
 
 	// Edit state
 	editStep   entryStep
@@ -85,44 +89,140 @@ type model struct {
 	deleteTargetName    string
 
 	// Multi-line text editing
-	currentText string
-	textLines   []string
-	textCursor  int
-	charCursor  int // Position within current line
+	editor    textEditor
+	histories map[entryStep]*editHistory // Undo history per field for the current entry or edit
 
 	// Search results display state
 	displayMode  fieldDisplayMode
 	scrollOffset int // For scrolling individual field content
 
 	// UI state
-	message   string
-	clipboard string // Internal clipboard for copy/paste
+	message           string
+	status            string            // Outcome of the last clipboard or $EDITOR action
+	clipboard         string            // Internal clipboard for copy/paste
+	clipboardProvider clipboardProvider // How the system clipboard is reached
+	config            Config            // Loaded once at startup, for the redaction preview
+	width             int               // Terminal size, 0 until the first WindowSizeMsg
+	height            int
 }
 
+// checkingIndexStatus shows while the index is checked, and set up if need be,
+// at startup
+const checkingIndexStatus = "Checking the report index..."
+
 func initialModel() model {
+	config := LoadConfig()
 	return model{
 		state:         stateMenu,
 		cursor:        0,
 		filter:        Filter{},
 		searchResults: []ErrorReport{},
 		currentReport: ErrorReport{
-			Resources: []string{},
-			Date:      time.Now(),
+			Resources:   []string{},
+			Environment: CurrentEnvironment(),
+			Date:        time.Now(),
 		},
-		textLines:    []string{""},
-		textCursor:   0,
-		charCursor:   0,
-		displayMode:  fieldDisplayAll,
-		scrollOffset: 0,
+		editor:            newTextEditor(""),
+		status:            checkingIndexStatus,
+		clipboardProvider: detectClipboard(config.Clipboard),
+		config:            config,
+		displayMode:       fieldDisplayAll,
+		scrollOffset:      0,
 	}
 }
 
+// newEntryModel opens the UI straight into the entry form, pre-filled with report
+func newEntryModel(report ErrorReport) model {
+	m := initialModel()
+	m.state = stateEntry
+	m.entryStep = entryStepSymptom
+	m.currentReport = report
+	m.histories = map[entryStep]*editHistory{}
+	return m
+}
+
+// newSearchModel opens the UI on the search form with the query filled in,
+// ready to execute
+func newSearchModel(query string) model {
+	m := initialModel()
+	m.state = stateSearch
+	m.searchStep = searchStepExecute
+	m.filter.Q = query
+	return m
+}
+
+func runTUI(m model) error {
+	var opts []tea.ProgramOption
+	if !stdinIsTerminal() {
+		// stdin is input (or /dev/null), so read keys from the terminal
+		opts = append(opts, tea.WithInputTTY())
+	}
+
+	p := tea.NewProgram(m, opts...)
+	_, err := p.Run()
+	return err
+}
+
+// similarityIndexMsg delivers the similarity index, first from the local
+// cache and then once more after refreshing it from the server
+type similarityIndexMsg struct {
+	index     *similarityIndex
+	refreshed bool
+}
+
+func loadSimilarityIndexCmd() tea.Msg {
+	return similarityIndexMsg{index: loadSimilarityIndex()}
+}
+
+func refreshSimilarityIndexCmd() tea.Msg {
+	index, err := rebuildSimilarityIndex()
+	if err != nil {
+		slog.Error("Failed to refresh similarity index", "err", err)
+		return nil
+	}
+	return similarityIndexMsg{index: index, refreshed: true}
+}
+
+// indexReadyMsg reports the startup check of the index
+type indexReadyMsg struct {
+	initialized bool
+	err         error
+}
+
+func ensureIndexCmd() tea.Msg {
+	initialized, err := EnsureIndex()
+	return indexReadyMsg{initialized: initialized, err: err}
+}
+
 func (m model) Init() tea.Cmd {
-	return nil
+	if m.state == stateEntry {
+		return tea.Batch(ensureIndexCmd, loadSimilarityIndexCmd)
+	}
+	return ensureIndexCmd
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case similarityIndexMsg:
+		m.similarity = msg.index
+		m.updateRelated()
+		if !msg.refreshed {
+			return m, refreshSimilarityIndexCmd
+		}
+	case indexReadyMsg:
+		switch {
+		case msg.err != nil:
+			m.status = fmt.Sprintf("Could not set up the report index: %v", msg.err)
+		case msg.initialized:
+			m.status = "Set up the report index"
+		case m.status == checkingIndexStatus:
+			m.status = ""
+		}
+	case externalEditMsg:
+		return m.applyExternalEdit(msg)
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.resizeEditor()
 	case tea.KeyMsg:
 		switch m.state {
 		case stateMenu:
@@ -168,8 +268,14 @@ func (m model) updateMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.state = stateEntry
 			m.entryStep = entryStepSymptom
 			m.currentReport = ErrorReport{
-				Resources: []string{},
-				Date:      time.Now(),
+				Resources:   []string{},
+				Environment: CurrentEnvironment(),
+				Date:        time.Now(),
+			}
+			m.related = nil
+			m.histories = map[entryStep]*editHistory{}
+			if m.similarity == nil {
+				return m, loadSimilarityIndexCmd
 			}
 		}
 	}
@@ -183,6 +289,7 @@ func (m model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.cursor = 0
 	case "enter":
 		if m.searchStep == searchStepExecute {
+			m.filter.PreferEnvironment = CurrentEnvironment()
 			results, _ := SearchErrorReports(m.filter)
 			m.searchResults = results
 			m.state = stateSearchResults
@@ -270,6 +377,7 @@ func (m *model) updateSearchField(input string) {
 }
 
 func (m model) updateSearchResults(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.status = ""
 	switch msg.String() {
 	case "esc":
 		m.state = stateMenu
@@ -316,18 +424,23 @@ func (m model) updateSearchResults(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "a":
 		m.displayMode = fieldDisplayAll
 		m.scrollOffset = 0
+	case "y":
+		if len(m.searchResults) > 0 && m.cursor < len(m.searchResults) {
+			m.copyToClipboard(m.shownFieldText(m.searchResults[m.cursor]))
+		}
 	case "e", "enter":
 		if len(m.searchResults) > 0 && m.cursor < len(m.searchResults) {
 			m.editReport = m.searchResults[m.cursor]
 			m.originalID = m.editReport.ID
 			m.editStep = entryStepSymptom
+			m.histories = map[entryStep]*editHistory{}
 			m.state = stateEditResult
 		}
 	case "delete", "x":
 		if len(m.searchResults) > 0 && m.cursor < len(m.searchResults) {
 			selected := m.searchResults[m.cursor]
 			m.deleteTargetID = selected.ID
-			m.deleteTargetName = fmt.Sprintf("%s - %s", selected.Program, getFirstLine(selected.Symptom))
+			m.deleteTargetName = fmt.Sprintf("%s - %s", selected.Program, reportSummary(selected))
 			m.deleteConfirmCursor = 0
 			m.state = stateDeleteConfirm
 		}
@@ -336,6 +449,7 @@ func (m model) updateSearchResults(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m model) updateEditResult(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.status = ""
 	switch msg.String() {
 	case "esc":
 		m.state = stateSearchResults
@@ -347,14 +461,18 @@ func (m model) updateEditResult(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.cursor = 0
 		} else {
 			m.state = stateEditResultField
-			m.currentText = m.getEditFieldText()
-			m.textLines = strings.Split(m.currentText, "\n")
-			if len(m.textLines) == 0 {
-				m.textLines = []string{""}
-			}
-			m.textCursor = 0
-			m.charCursor = 0
+			m.openEditor(m.editStep, m.getEditFieldText())
+		}
+	case "ctrl+c":
+		if m.editStep < entryStepConfirm {
+			m.copyToClipboard(m.getEditFieldText(), "field")
 		}
+	case "ctrl+e":
+		if m.editStep < entryStepConfirm {
+			return m, editExternally(externalEditField, m.getEditFieldText(), ".txt")
+		}
+	case "ctrl+r":
+		return m, m.editReportExternally(m.editReport)
 	case "tab":
 		if m.editStep < entryStepConfirm {
 			m.editStep++
@@ -368,26 +486,41 @@ func (m model) updateEditResult(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m model) updateEntry(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.status = ""
 	switch msg.String() {
 	case "esc":
 		m.state = stateMenu
 		m.cursor = 0
 	case "enter":
 		if m.entryStep == entryStepConfirm {
-			SaveErrorReport(m.currentReport)
-			m.message = "Error report saved successfully!"
+			id, err := SaveErrorReport(m.currentReport)
+			if err != nil {
+				m.message = fmt.Sprintf("Error saving report: %v", err)
+			} else {
+				m.message = "Error report saved successfully!"
+				if m.similarity != nil {
+					saved := m.currentReport
+					saved.ID = id
+					m.similarity.Add(saved)
+					m.similarity.Save()
+				}
+			}
 			m.state = stateMenu
 			m.cursor = 0
 		} else {
 			m.state = stateEntryField
-			m.currentText = m.getCurrentFieldText()
-			m.textLines = strings.Split(m.currentText, "\n")
-			if len(m.textLines) == 0 {
-				m.textLines = []string{""}
-			}
-			m.textCursor = 0
-			m.charCursor = 0
+			m.openEditor(m.entryStep, m.getCurrentFieldText())
 		}
+	case "ctrl+c":
+		if m.entryStep < entryStepConfirm {
+			m.copyToClipboard(m.getCurrentFieldText(), "field")
+		}
+	case "ctrl+e":
+		if m.entryStep < entryStepConfirm {
+			return m, editExternally(externalEditField, m.getCurrentFieldText(), ".txt")
+		}
+	case "ctrl+r":
+		return m, m.editReportExternally(m.currentReport)
 	case "tab":
 		if m.entryStep < entryStepConfirm {
 			m.entryStep++
@@ -412,8 +545,12 @@ func (m model) getCurrentFieldText() string {
 		return m.currentReport.Distro
 	case entryStepDistroVersion:
 		return m.currentReport.DistroVersion
+	case entryStepTeam:
+		return m.currentReport.Team
 	case entryStepResources:
 		return strings.Join(m.currentReport.Resources, "\n")
+	case entryStepEnvironment:
+		return formatEnvironment(m.currentReport.Environment, "\n")
 	case entryStepSolution:
 		return m.currentReport.Solution
 	}
@@ -432,6 +569,8 @@ func (m *model) setCurrentFieldText(text string) {
 		m.currentReport.Distro = text
 	case entryStepDistroVersion:
 		m.currentReport.DistroVersion = text
+	case entryStepTeam:
+		m.currentReport.Team = strings.TrimSpace(text)
 	case entryStepResources:
 		lines := strings.Split(text, "\n")
 		resources := []string{}
@@ -441,6 +580,8 @@ func (m *model) setCurrentFieldText(text string) {
 			}
 		}
 		m.currentReport.Resources = resources
+	case entryStepEnvironment:
+		m.currentReport.Environment = parseEnvironment(text)
 	case entryStepSolution:
 		m.currentReport.Solution = text
 	}
@@ -458,8 +599,12 @@ func (m model) getEditFieldText() string {
 		return m.editReport.Distro
 	case entryStepDistroVersion:
 		return m.editReport.DistroVersion
+	case entryStepTeam:
+		return m.editReport.Team
 	case entryStepResources:
 		return strings.Join(m.editReport.Resources, "\n")
+	case entryStepEnvironment:
+		return formatEnvironment(m.editReport.Environment, "\n")
 	case entryStepSolution:
 		return m.editReport.Solution
 	}
@@ -478,6 +623,8 @@ func (m *model) setEditFieldText(text string) {
 		m.editReport.Distro = text
 	case entryStepDistroVersion:
 		m.editReport.DistroVersion = text
+	case entryStepTeam:
+		m.editReport.Team = strings.TrimSpace(text)
 	case entryStepResources:
 		lines := strings.Split(text, "\n")
 		resources := []string{}
@@ -487,6 +634,8 @@ func (m *model) setEditFieldText(text string) {
 			}
 		}
 		m.editReport.Resources = resources
+	case entryStepEnvironment:
+		m.editReport.Environment = parseEnvironment(text)
 	case entryStepSolution:
 		m.editReport.Solution = text
 	}
@@ -533,231 +682,208 @@ func (m model) updateDeleteConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m model) updateEntryField(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.status = ""
 	switch msg.String() {
 	case "esc":
 		m.state = stateEntry
 	case "ctrl+s":
-		text := strings.Join(m.textLines, "\n")
-		m.setCurrentFieldText(text)
+		m.saveEntryField(m.editor.Value())
 		m.state = stateEntry
-	case "ctrl+c":
-		// Copy current line to clipboard
-		if m.textCursor < len(m.textLines) {
-			m.clipboard = m.textLines[m.textCursor]
-			m.copyToSystemClipboard(m.clipboard)
-		}
-	case "ctrl+v":
-		// Paste from clipboard
-		clipText := m.getFromSystemClipboard()
-		if clipText != "" {
-			m.clipboard = clipText
-		}
-		if m.clipboard != "" {
-			// Insert clipboard content at current cursor position
-			currentLine := m.textLines[m.textCursor]
-			newLine := currentLine[:m.charCursor] + m.clipboard + currentLine[m.charCursor:]
-			m.textLines[m.textCursor] = newLine
-			m.charCursor += len(m.clipboard)
-		}
-	case "enter":
-		// Split current line at cursor position
-		currentLine := m.textLines[m.textCursor]
-		leftPart := currentLine[:m.charCursor]
-		rightPart := currentLine[m.charCursor:]
-		m.textLines[m.textCursor] = leftPart
-		m.textLines = append(m.textLines[:m.textCursor+1], m.textLines[m.textCursor:]...)
-		m.textLines[m.textCursor+1] = rightPart
-		m.textCursor++
-		m.charCursor = 0
-	case "up":
-		if m.textCursor > 0 {
-			m.textCursor--
-			// Keep char cursor within bounds of new line
-			if m.charCursor > len(m.textLines[m.textCursor]) {
-				m.charCursor = len(m.textLines[m.textCursor])
-			}
-		}
-	case "down":
-		if m.textCursor < len(m.textLines)-1 {
-			m.textCursor++
-			// Keep char cursor within bounds of new line
-			if m.charCursor > len(m.textLines[m.textCursor]) {
-				m.charCursor = len(m.textLines[m.textCursor])
-			}
-		}
-	case "left":
-		if m.charCursor > 0 {
-			m.charCursor--
-		} else if m.textCursor > 0 {
-			// Move to end of previous line
-			m.textCursor--
-			m.charCursor = len(m.textLines[m.textCursor])
-		}
-	case "right":
-		if m.charCursor < len(m.textLines[m.textCursor]) {
-			m.charCursor++
-		} else if m.textCursor < len(m.textLines)-1 {
-			// Move to start of next line
-			m.textCursor++
-			m.charCursor = 0
+	case "ctrl+e":
+		return m, editExternally(externalEditEditor, m.editor.Value(), ".txt")
+	default:
+		m.updateEditor(msg)
+	}
+	m.updateRelated()
+	return m, nil
+}
+
+// saveEntryField stores the edited text in the new report's current field
+func (m *model) saveEntryField(text string) {
+	m.setCurrentFieldText(text)
+	if m.entryStep != entryStepSymptom {
+		return
+	}
+	if m.currentReport.Program == "" {
+		// Fill in the program from the shape of the symptom, e.g. a
+		// Python traceback or rustc output
+		m.currentReport.Program = DetectProgram(text)
+	}
+	// Keep only the exception and top frames of a runtime crash
+	symptom, traceback := normalizeTracebackSymptom(text)
+	if traceback != nil && symptom != text {
+		m.currentReport.Symptom = symptom
+		m.status = fmt.Sprintf("Kept the exception and top frames of the %s traceback", traceback.Language)
+	}
+}
+
+// editReportExternally opens the whole report in $EDITOR as Markdown with
+// YAML front matter
+func (m *model) editReportExternally(report ErrorReport) tea.Cmd {
+	document, err := reportToMarkdown(report)
+	if err != nil {
+		m.status = err.Error()
+		return nil
+	}
+	return editExternally(externalEditReport, document, ".md")
+}
+
+// applyExternalEdit loads the result of editing in $EDITOR back into the
+// field, editor or report it came from
+func (m model) applyExternalEdit(msg externalEditMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.status = fmt.Sprintf("Editor failed: %v", msg.err)
+		return m, nil
+	}
+	m.status = ""
+
+	editing := m.state == stateEditResult || m.state == stateEditResultField
+	switch msg.target {
+	case externalEditEditor:
+		m.editor.SetText(msg.text)
+	case externalEditField:
+		if editing {
+			m.setEditFieldText(msg.text)
 		} else {
-			// Jump to end of current line if trying to go past it
-			m.charCursor = len(m.textLines[m.textCursor])
+			m.saveEntryField(msg.text)
 		}
-	case "home":
-		m.charCursor = 0
-	case "end":
-		m.charCursor = len(m.textLines[m.textCursor])
-	case "backspace":
-		if m.charCursor > 0 {
-			// Remove character before cursor
-			currentLine := m.textLines[m.textCursor]
-			m.textLines[m.textCursor] = currentLine[:m.charCursor-1] + currentLine[m.charCursor:]
-			m.charCursor--
-		} else if m.textCursor > 0 {
-			// Join with previous line
-			prevLine := m.textLines[m.textCursor-1]
-			currentLine := m.textLines[m.textCursor]
-			m.textLines[m.textCursor-1] = prevLine + currentLine
-			m.textLines = append(m.textLines[:m.textCursor], m.textLines[m.textCursor+1:]...)
-			m.textCursor--
-			m.charCursor = len(prevLine)
+	case externalEditReport:
+		report := m.currentReport
+		if editing {
+			report = m.editReport
 		}
-	case "delete":
-		if m.charCursor < len(m.textLines[m.textCursor]) {
-			// Remove character at cursor
-			currentLine := m.textLines[m.textCursor]
-			m.textLines[m.textCursor] = currentLine[:m.charCursor] + currentLine[m.charCursor+1:]
-		} else if m.textCursor < len(m.textLines)-1 {
-			// Join with next line
-			currentLine := m.textLines[m.textCursor]
-			nextLine := m.textLines[m.textCursor+1]
-			m.textLines[m.textCursor] = currentLine + nextLine
-			m.textLines = append(m.textLines[:m.textCursor+1], m.textLines[m.textCursor+2:]...)
+		report, err := applyMarkdownReport(report, msg.text)
+		if err != nil {
+			m.status = fmt.Sprintf("Could not read the edited report: %v", err)
+			return m, nil
 		}
-	default:
-		if len(msg.String()) == 1 {
-			// Insert character at cursor position
-			currentLine := m.textLines[m.textCursor]
-			m.textLines[m.textCursor] = currentLine[:m.charCursor] + msg.String() + currentLine[m.charCursor:]
-			m.charCursor++
+		if editing {
+			m.editReport = report
+		} else {
+			if report.Program == "" {
+				report.Program = DetectProgram(report.Symptom)
+			}
+			report.Symptom, _ = normalizeTracebackSymptom(report.Symptom)
+			m.currentReport = report
 		}
 	}
+	m.updateRelated()
 	return m, nil
 }
 
+// updateRelated refreshes the "possibly related" panel from the symptom,
+// including unsaved changes while the symptom is being edited
+func (m *model) updateRelated() {
+	symptom := m.currentReport.Symptom
+	if m.state == stateEntryField && m.entryStep == entryStepSymptom {
+		symptom = m.editor.Value()
+	}
+	m.related = m.similarity.Related(symptom)
+}
+
+// viewStatus shows the status line: the startup index check, or the outcome
+// of the last clipboard or $EDITOR action
+func (m model) viewStatus() string {
+	if m.status == "" {
+		return ""
+	}
+	return "\n" + statusStyle.Render("! "+m.status) + "\n"
+}
+
+// maxRedactionPreview is how many redactions the confirm step lists
+const maxRedactionPreview = 8
+
+// viewRedactionPreview lists what saving report will redact
+func (m model) viewRedactionPreview(report ErrorReport) string {
+	findings := previewRedactions(report, m.config)
+	if len(findings) == 0 {
+		return ""
+	}
+
+	s := "\nWill be redacted before saving:\n"
+	for i, finding := range findings {
+		if i == maxRedactionPreview {
+			s += fmt.Sprintf("  ...and %d more\n", len(findings)-i)
+			break
+		}
+		s += fmt.Sprintf("  %s: %s %s\n", finding.Field, finding.Rule, finding.Match)
+	}
+	return s
+}
+
+func (m model) viewRelated() string {
+	if len(m.related) == 0 {
+		return ""
+	}
+
+	s := "\nPossibly related:\n"
+	for _, related := range m.related {
+		s += fmt.Sprintf("  %3.0f%%  %s - %s (%s)\n", related.Score*100, related.Program, related.Summary, related.ID)
+	}
+	return s
+}
+
 func (m model) updateEditResultField(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.status = ""
 	switch msg.String() {
 	case "esc":
 		m.state = stateEditResult
 	case "ctrl+s":
-		text := strings.Join(m.textLines, "\n")
-		m.setEditFieldText(text)
+		m.setEditFieldText(m.editor.Value())
 		m.state = stateEditResult
+	case "ctrl+e":
+		return m, editExternally(externalEditEditor, m.editor.Value(), ".txt")
+	default:
+		m.updateEditor(msg)
+	}
+	return m, nil
+}
+
+// openEditor loads a field's text into the editor, picking up the field's
+// undo history from earlier in the session
+func (m *model) openEditor(step entryStep, text string) {
+	m.editor = newTextEditor(text)
+	if m.histories == nil {
+		m.histories = map[entryStep]*editHistory{}
+	}
+	if history, ok := m.histories[step]; ok {
+		history.seal()
+		m.editor.history = history
+	} else {
+		m.histories[step] = m.editor.history
+	}
+	m.resizeEditor()
+}
+
+// resizeEditor fits the editor to the terminal, leaving room for the title,
+// help text and related reports panel
+func (m *model) resizeEditor() {
+	if m.width == 0 {
+		return
+	}
+	m.editor.SetSize(m.width-3, m.height-14)
+}
+
+// updateEditor handles a key press in the field editor shared by the entry
+// and edit forms
+func (m *model) updateEditor(msg tea.KeyMsg) {
+	switch msg.String() {
 	case "ctrl+c":
-		// Copy current line to clipboard
-		if m.textCursor < len(m.textLines) {
-			m.clipboard = m.textLines[m.textCursor]
-			m.copyToSystemClipboard(m.clipboard)
-		}
-	case "ctrl+v":
-		// Paste from clipboard
-		clipText := m.getFromSystemClipboard()
-		if clipText != "" {
-			m.clipboard = clipText
-		}
-		if m.clipboard != "" {
-			// Insert clipboard content at current cursor position
-			currentLine := m.textLines[m.textCursor]
-			newLine := currentLine[:m.charCursor] + m.clipboard + currentLine[m.charCursor:]
-			m.textLines[m.textCursor] = newLine
-			m.charCursor += len(m.clipboard)
-		}
-	case "enter":
-		// Split current line at cursor position
-		currentLine := m.textLines[m.textCursor]
-		leftPart := currentLine[:m.charCursor]
-		rightPart := currentLine[m.charCursor:]
-		m.textLines[m.textCursor] = leftPart
-		m.textLines = append(m.textLines[:m.textCursor+1], m.textLines[m.textCursor:]...)
-		m.textLines[m.textCursor+1] = rightPart
-		m.textCursor++
-		m.charCursor = 0
-	case "up":
-		if m.textCursor > 0 {
-			m.textCursor--
-			// Keep char cursor within bounds of new line
-			if m.charCursor > len(m.textLines[m.textCursor]) {
-				m.charCursor = len(m.textLines[m.textCursor])
-			}
-		}
-	case "down":
-		if m.textCursor < len(m.textLines)-1 {
-			m.textCursor++
-			// Keep char cursor within bounds of new line
-			if m.charCursor > len(m.textLines[m.textCursor]) {
-				m.charCursor = len(m.textLines[m.textCursor])
-			}
-		}
-	case "left":
-		if m.charCursor > 0 {
-			m.charCursor--
-		} else if m.textCursor > 0 {
-			// Move to end of previous line
-			m.textCursor--
-			m.charCursor = len(m.textLines[m.textCursor])
-		}
-	case "right":
-		if m.charCursor < len(m.textLines[m.textCursor]) {
-			m.charCursor++
-		} else if m.textCursor < len(m.textLines)-1 {
-			// Move to start of next line
-			m.textCursor++
-			m.charCursor = 0
+		// Copy the selection, or the current line when nothing is selected
+		if selected := m.editor.SelectedText(); selected != "" {
+			m.copyToClipboard(selected, "selection")
 		} else {
-			// Jump to end of current line if trying to go past it
-			m.charCursor = len(m.textLines[m.textCursor])
+			m.copyToClipboard(m.editor.CurrentLine(), "line")
 		}
-	case "home":
-		m.charCursor = 0
-	case "end":
-		m.charCursor = len(m.textLines[m.textCursor])
-	case "backspace":
-		if m.charCursor > 0 {
-			// Remove character before cursor
-			currentLine := m.textLines[m.textCursor]
-			m.textLines[m.textCursor] = currentLine[:m.charCursor-1] + currentLine[m.charCursor:]
-			m.charCursor--
-		} else if m.textCursor > 0 {
-			// Join with previous line
-			prevLine := m.textLines[m.textCursor-1]
-			currentLine := m.textLines[m.textCursor]
-			m.textLines[m.textCursor-1] = prevLine + currentLine
-			m.textLines = append(m.textLines[:m.textCursor], m.textLines[m.textCursor+1:]...)
-			m.textCursor--
-			m.charCursor = len(prevLine)
-		}
-	case "delete":
-		if m.charCursor < len(m.textLines[m.textCursor]) {
-			// Remove character at cursor
-			currentLine := m.textLines[m.textCursor]
-			m.textLines[m.textCursor] = currentLine[:m.charCursor] + currentLine[m.charCursor+1:]
-		} else if m.textCursor < len(m.textLines)-1 {
-			// Join with next line
-			currentLine := m.textLines[m.textCursor]
-			nextLine := m.textLines[m.textCursor+1]
-			m.textLines[m.textCursor] = currentLine + nextLine
-			m.textLines = append(m.textLines[:m.textCursor+1], m.textLines[m.textCursor+2:]...)
+	case "alt+c":
+		m.copyToClipboard(m.editor.Value(), "field")
+	case "ctrl+v":
+		if text := m.pasteFromClipboard(); text != "" {
+			m.editor.InsertText(text)
 		}
 	default:
-		if len(msg.String()) == 1 {
-			// Insert character at cursor position
-			currentLine := m.textLines[m.textCursor]
-			m.textLines[m.textCursor] = currentLine[:m.charCursor] + msg.String() + currentLine[m.charCursor:]
-			m.charCursor++
-		}
+		m.editor.HandleKey(msg)
 	}
-	return m, nil
 }
 
 func (m model) View() string {
@@ -783,7 +909,7 @@ func (m model) View() string {
 }
 
 func (m model) viewMenu() string {
-	s := "Error Report Manager\n\n"
+	s := titleStyle.Render("Error Report Manager") + "\n\n"
 
 	if m.message != "" {
 		s += fmt.Sprintf("✓ %s\n\n", m.message)
@@ -802,12 +928,13 @@ func (m model) viewMenu() string {
 		s += fmt.Sprintf("%s %s\n", cursor, option)
 	}
 
+	s += m.viewStatus()
 	s += "\nPress q to quit"
 	return s
 }
 
 func (m model) viewSearch() string {
-	s := "Search Error Reports\n\n"
+	s := titleStyle.Render("Search Error Reports") + "\n\n"
 
 	fields := []struct {
 		label string
@@ -850,8 +977,17 @@ func getFirstLine(text string) string {
 	return text
 }
 
+// reportSummary is the one-line description of a report shown in lists: its
+// headline when the symptom was compiler output, its first line otherwise
+func reportSummary(report ErrorReport) string {
+	if report.Headline != "" {
+		return report.Headline
+	}
+	return getFirstLine(report.Symptom)
+}
+
 func (m model) viewSearchResults() string {
-	s := "Search Results\n\n"
+	s := titleStyle.Render("Search Results") + "\n\n"
 
 	if len(m.searchResults) == 0 {
 		s += "No results found"
@@ -861,7 +997,7 @@ func (m model) viewSearchResults() string {
 			if m.cursor == i {
 				cursor = ">"
 			}
-			s += fmt.Sprintf("%s %s - %s\n", cursor, result.Program, getFirstLine(result.Symptom))
+			s += fmt.Sprintf("%s %s - %s\n", cursor, result.Program, reportSummary(result))
 		}
 
 		if len(m.searchResults) > 0 && m.cursor < len(m.searchResults) {
@@ -873,10 +1009,19 @@ func (m model) viewSearchResults() string {
 				s += fmt.Sprintf("Date: %s\n", selected.Date.Format("2006-01-02"))
 				s += fmt.Sprintf("Program: %s %s\n", selected.Program, selected.ProgramVersion)
 				s += fmt.Sprintf("Distro: %s %s\n", selected.Distro, selected.DistroVersion)
+				if selected.Team != "" {
+					s += fmt.Sprintf("Team: %s\n", selected.Team)
+				}
 				s += fmt.Sprintf("Symptom: %s\n", selected.Symptom)
 				if len(selected.Resources) > 0 {
 					s += fmt.Sprintf("Resources: %s\n", strings.Join(selected.Resources, ", "))
 				}
+				if len(selected.Environment) > 0 {
+					s += fmt.Sprintf("Environment: %s\n", formatEnvironment(selected.Environment, ", "))
+				}
+				if len(selected.Extracted) > 0 {
+					s += fmt.Sprintf("Extracted: %s\n", formatExtracted(selected.Extracted, "; "))
+				}
 				s += fmt.Sprintf("Solution: %s\n", selected.Solution)
 			case fieldDisplaySymptom:
 				s += fmt.Sprintf("Symptom (scroll: j/k):\n")
@@ -896,7 +1041,9 @@ func (m model) viewSearchResults() string {
 		}
 	}
 
+	s += m.viewStatus()
 	s += "\nPress s=symptom, p=program, d=distro, o=solution, a=all"
+	s += "\nPress y to copy the field shown (the solution in the full view)"
 	s += "\nPress Enter/e to edit, x to delete, Esc to go back"
 	return s
 }
@@ -948,6 +1095,20 @@ func (m model) renderScrollableField(text string) string {
 	return result
 }
 
+// shownFieldText is the text of the field on display for a search result,
+// the solution when showing them all, and its name
+func (m model) shownFieldText(selected ErrorReport) (string, string) {
+	switch m.displayMode {
+	case fieldDisplaySymptom:
+		return selected.Symptom, "symptom"
+	case fieldDisplayProgram:
+		return strings.TrimSpace(selected.Program + " " + selected.ProgramVersion), "program"
+	case fieldDisplayDistro:
+		return strings.TrimSpace(selected.Distro + " " + selected.DistroVersion), "distro"
+	}
+	return selected.Solution, "solution"
+}
+
 func (m model) getMaxScrollForCurrentField() int {
 	if len(m.searchResults) == 0 || m.cursor >= len(m.searchResults) {
 		return 0
@@ -991,7 +1152,7 @@ func (m model) getMaxScrollForCurrentField() int {
 }
 
 func (m model) viewEntry() string {
-	s := "Enter New Error Report\n\n"
+	s := titleStyle.Render("Enter New Error Report") + "\n\n"
 
 	fields := []struct {
 		label string
@@ -1003,7 +1164,9 @@ func (m model) viewEntry() string {
 		{"Program Version", m.currentReport.ProgramVersion, entryStepProgramVersion},
 		{"Distro", m.currentReport.Distro, entryStepDistro},
 		{"Distro Version", m.currentReport.DistroVersion, entryStepDistroVersion},
+		{"Team", m.currentReport.Team, entryStepTeam},
 		{"Resources", strings.Join(m.currentReport.Resources, ", "), entryStepResources},
+		{"Environment", formatEnvironment(m.currentReport.Environment, ", "), entryStepEnvironment},
 		{"Solution", m.currentReport.Solution, entryStepSolution},
 	}
 
@@ -1012,10 +1175,7 @@ func (m model) viewEntry() string {
 		if m.entryStep == field.step {
 			cursor = ">"
 		}
-		displayValue := field.value
-		if len(displayValue) > 50 {
-			displayValue = displayValue[:50] + "..."
-		}
+		displayValue := truncateDisplay(field.value, 50)
 		s += fmt.Sprintf("%s %s: %s\n", cursor, field.label, displayValue)
 	}
 
@@ -1024,8 +1184,19 @@ func (m model) viewEntry() string {
 		cursor = ">"
 	}
 	s += fmt.Sprintf("%s Save Report\n", cursor)
+	if m.entryStep == entryStepConfirm {
+		s += m.viewRedactionPreview(m.currentReport)
+	}
+
+	if headline := deriveHeadline(m.currentReport.Symptom); headline != "" {
+		s += fmt.Sprintf("\nDetected: %s\n", headline)
+	}
+	s += m.viewRelated()
+
+	s += m.viewStatus()
 
 	s += "\nPress Enter to edit field, Tab/Shift+Tab to navigate, Esc to go back"
+	s += "\nPress Ctrl+C to copy the field, Ctrl+E to edit it in $EDITOR, Ctrl+R to edit the whole report"
 	return s
 }
 
@@ -1033,44 +1204,14 @@ func (m model) viewEntryField() string {
 	fieldName := m.getCurrentFieldName()
 	s := fmt.Sprintf("Edit %s\n\n", fieldName)
 
-	const lineWidth = 70 // Maximum line width before wrapping
-
-	for i, line := range m.textLines {
-		// Wrap long lines for display
-		wrappedLines := wrapLine(line, lineWidth)
-
-		for j, wrappedLine := range wrappedLines {
-			lineCursor := " "
-			if i == m.textCursor {
-				if j == 0 {
-					lineCursor = ">"
-				} else {
-					lineCursor = "|"
-				}
-				// Show cursor position within the line
-				// Calculate cursor position relative to wrapped lines
-				cursorPos := m.charCursor
-				for k := 0; k < j; k++ {
-					if k < len(wrappedLines)-1 {
-						cursorPos -= len(wrappedLines[k])
-					}
-				}
+	s += m.editor.View()
 
-				if cursorPos >= 0 && cursorPos <= len(wrappedLine) {
-					// Insert cursor marker
-					if cursorPos == len(wrappedLine) {
-						wrappedLine += "█"
-					} else {
-						wrappedLine = wrappedLine[:cursorPos] + "█" + wrappedLine[cursorPos:]
-					}
-				}
-			}
-			s += fmt.Sprintf("%s %s\n", lineCursor, wrappedLine)
-		}
+	if m.entryStep == entryStepSymptom {
+		s += m.viewRelated()
 	}
 
-	s += "\nPress Ctrl+S to save, Esc to cancel, Enter for new line"
-	s += "\nArrow keys to navigate, Ctrl+C to copy line, Ctrl+V to paste"
+	s += m.viewStatus()
+	s += editorHelp
 	return s
 }
 
@@ -1086,8 +1227,12 @@ func (m model) getCurrentFieldName() string {
 		return "Distro"
 	case entryStepDistroVersion:
 		return "Distro Version"
+	case entryStepTeam:
+		return "Team"
 	case entryStepResources:
 		return "Resources (one per line)"
+	case entryStepEnvironment:
+		return "Environment (key=value, one per line)"
 	case entryStepSolution:
 		return "Solution"
 	}
@@ -1095,7 +1240,7 @@ func (m model) getCurrentFieldName() string {
 }
 
 func (m model) viewEditResult() string {
-	s := "Edit Error Report\n\n"
+	s := titleStyle.Render("Edit Error Report") + "\n\n"
 
 	fields := []struct {
 		label string
@@ -1107,7 +1252,9 @@ func (m model) viewEditResult() string {
 		{"Program Version", m.editReport.ProgramVersion, entryStepProgramVersion},
 		{"Distro", m.editReport.Distro, entryStepDistro},
 		{"Distro Version", m.editReport.DistroVersion, entryStepDistroVersion},
+		{"Team", m.editReport.Team, entryStepTeam},
 		{"Resources", strings.Join(m.editReport.Resources, ", "), entryStepResources},
+		{"Environment", formatEnvironment(m.editReport.Environment, ", "), entryStepEnvironment},
 		{"Solution", m.editReport.Solution, entryStepSolution},
 	}
 
@@ -1116,10 +1263,7 @@ func (m model) viewEditResult() string {
 		if m.editStep == field.step {
 			cursor = ">"
 		}
-		displayValue := field.value
-		if len(displayValue) > 50 {
-			displayValue = displayValue[:50] + "..."
-		}
+		displayValue := truncateDisplay(field.value, 50)
 		s += fmt.Sprintf("%s %s: %s\n", cursor, field.label, displayValue)
 	}
 
@@ -1128,8 +1272,14 @@ func (m model) viewEditResult() string {
 		cursor = ">"
 	}
 	s += fmt.Sprintf("%s Update Report\n", cursor)
+	if m.editStep == entryStepConfirm {
+		s += m.viewRedactionPreview(m.editReport)
+	}
+
+	s += m.viewStatus()
 
 	s += "\nPress Enter to edit field, Tab/Shift+Tab to navigate, Esc to go back"
+	s += "\nPress Ctrl+C to copy the field, Ctrl+E to edit it in $EDITOR, Ctrl+R to edit the whole report"
 	return s
 }
 
@@ -1137,44 +1287,9 @@ func (m model) viewEditResultField() string {
 	fieldName := m.getEditFieldName()
 	s := fmt.Sprintf("Edit %s\n\n", fieldName)
 
-	const lineWidth = 70 // Maximum line width before wrapping
-
-	for i, line := range m.textLines {
-		// Wrap long lines for display
-		wrappedLines := wrapLine(line, lineWidth)
-
-		for j, wrappedLine := range wrappedLines {
-			lineCursor := " "
-			if i == m.textCursor {
-				if j == 0 {
-					lineCursor = ">"
-				} else {
-					lineCursor = "|"
-				}
-				// Show cursor position within the line
-				// Calculate cursor position relative to wrapped lines
-				cursorPos := m.charCursor
-				for k := 0; k < j; k++ {
-					if k < len(wrappedLines)-1 {
-						cursorPos -= len(wrappedLines[k])
-					}
-				}
-
-				if cursorPos >= 0 && cursorPos <= len(wrappedLine) {
-					// Insert cursor marker
-					if cursorPos == len(wrappedLine) {
-						wrappedLine += "█"
-					} else {
-						wrappedLine = wrappedLine[:cursorPos] + "█" + wrappedLine[cursorPos:]
-					}
-				}
-			}
-			s += fmt.Sprintf("%s %s\n", lineCursor, wrappedLine)
-		}
-	}
-
-	s += "\nPress Ctrl+S to save, Esc to cancel, Enter for new line"
-	s += "\nArrow keys to navigate, Ctrl+C to copy line, Ctrl+V to paste"
+	s += m.editor.View()
+	s += m.viewStatus()
+	s += editorHelp
 	return s
 }
 
@@ -1190,55 +1305,47 @@ func (m model) getEditFieldName() string {
 		return "Distro"
 	case entryStepDistroVersion:
 		return "Distro Version"
+	case entryStepTeam:
+		return "Team"
 	case entryStepResources:
 		return "Resources (one per line)"
+	case entryStepEnvironment:
+		return "Environment (key=value, one per line)"
 	case entryStepSolution:
 		return "Solution"
 	}
 	return ""
 }
 
-// copyToSystemClipboard copies text to system clipboard
-func (m *model) copyToSystemClipboard(text string) {
-	var cmd *exec.Cmd
-	switch runtime.GOOS {
-	case "linux":
-		cmd = exec.Command("xclip", "-selection", "clipboard")
-	case "darwin":
-		cmd = exec.Command("pbcopy")
-	case "windows":
-		cmd = exec.Command("clip")
-	default:
-		return // Unsupported OS
+// copyToClipboard puts text on goof's own clipboard and the system one
+func (m *model) copyToClipboard(text, what string) {
+	m.clipboard = text
+	if err := m.clipboardProvider.Copy(text); err != nil {
+		slog.Error("Failed to copy", "clipboard", m.clipboardProvider.Name(), "err", err)
+		m.status = fmt.Sprintf("Copied %s within goof only: %v", what, err)
+		return
 	}
-
-	cmd.Stdin = strings.NewReader(text)
-	cmd.Run() // Ignore errors for now
+	m.status = fmt.Sprintf("Copied %s", what)
 }
 
-// getFromSystemClipboard gets text from system clipboard
-func (m *model) getFromSystemClipboard() string {
-	var cmd *exec.Cmd
-	switch runtime.GOOS {
-	case "linux":
-		cmd = exec.Command("xclip", "-selection", "clipboard", "-o")
-	case "darwin":
-		cmd = exec.Command("pbpaste")
-	case "windows":
-		cmd = exec.Command("powershell", "-command", "Get-Clipboard")
-	default:
-		return "" // Unsupported OS
-	}
-
-	out, err := cmd.Output()
+// pasteFromClipboard reads the system clipboard, falling back to goof's own
+// when the system one can't be read, as with OSC 52
+func (m *model) pasteFromClipboard() string {
+	text, err := m.clipboardProvider.Paste()
 	if err != nil {
-		return ""
+		if !errors.Is(err, errPasteUnsupported) {
+			slog.Error("Failed to paste", "clipboard", m.clipboardProvider.Name(), "err", err)
+		}
+		return m.clipboard
+	}
+	if text != "" {
+		m.clipboard = text
 	}
-	return strings.TrimSpace(string(out))
+	return m.clipboard
 }
 
 func (m model) viewDeleteConfirm() string {
-	s := "Delete Error Report\n\n"
+	s := titleStyle.Render("Delete Error Report") + "\n\n"
 	s += fmt.Sprintf("Are you sure you want to delete this report?\n\n")
 	s += fmt.Sprintf("Report: %s\n\n", m.deleteTargetName)
 
@@ -1261,58 +1368,83 @@ func (m model) viewDeleteConfirm() string {
 
 // wrapLine wraps a line to fit within the specified width
 func wrapLine(line string, width int) []string {
-	if width <= 0 {
-		return []string{line}
-	}
-
-	if len(line) <= width {
-		return []string{line}
-	}
-
 	var wrapped []string
-	for len(line) > width {
-		// Try to break at word boundary
-		breakPoint := width
-		for i := width - 1; i >= 0; i-- {
-			if line[i] == ' ' {
-				breakPoint = i
-				break
-			}
-		}
-
-		wrapped = append(wrapped, strings.TrimSpace(line[:breakPoint]))
-		line = strings.TrimSpace(line[breakPoint:])
+	for _, segment := range wrapSegments(line, width) {
+		wrapped = append(wrapped, strings.TrimSpace(line[segment[0]:segment[1]]))
 	}
+	return wrapped
+}
 
-	if len(line) > 0 {
-		wrapped = append(wrapped, line)
+// truncateDisplay shortens text to width columns without splitting characters
+func truncateDisplay(text string, width int) string {
+	if textWidth(text) <= width {
+		return text
 	}
-
-	return wrapped
+	return text[:columnForX(text, width)] + "..."
 }
 
 func main() {
-	initIndex := flag.Bool("init-index", false, "Initialize Meilisearch index with proper attributes")
-	debugMode := flag.Bool("debug", false, "Enable debug logging")
-	logFile := flag.String("log-file", "errors.log", "File to write debug logs to")
+	initIndex := flag.Bool("init-index", false, "Initialize the Meilisearch index (or the file store) for first use")
+	debugMode := flag.Bool("debug", false, "Enable debug logging (same as -log-level debug)")
+	logLevel := flag.String("log-level", "off", "Log `level`: debug, info, warn, error or off")
+	logFormat := flag.String("log-format", "text", "Log `format`: text or json")
+	logFile := flag.String("log-file", "errors.log", "File to write logs to, rotated when it reaches 5 MB")
+	searchMode := flag.Bool("search", false, "Use piped stdin as a search query instead of a new report's symptom")
+	flag.StringVar(&configFlags.Profile, "profile", "", "Config file profile to use (default $GOOF_PROFILE or the file's default_profile)")
+	flag.StringVar(&configFlags.Backend, "backend", "", "Where reports are kept: meilisearch or file")
+	flag.StringVar(&configFlags.URL, "url", "", "Meilisearch URL")
+	flag.StringVar(&configFlags.Index, "index", "", "Meilisearch index, or the file backend's file name")
+	flag.Usage = func() { printUsage(os.Stderr) }
 	flag.Parse()
 
-	// Initialize debug logging with the provided flags
-	initDebugLogging(*debugMode, *logFile)
+	if *debugMode {
+		*logLevel = "debug"
+	}
+	if err := initLogging(*logLevel, *logFormat, *logFile); err != nil {
+		fmt.Fprintf(os.Stderr, "goof: %v\n", err)
+		os.Exit(2)
+	}
+	applyTheme(LoadConfig().Theme)
+
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
 
 	if *initIndex {
-		logToFile("Initializing Meilisearch index...\n")
+		slog.Info("Initializing index")
 		if err := InitializeIndexIfNeeded(); err != nil {
-			logToFile("Error initializing index: %v\n", err)
+			slog.Error("Failed to initialize index", "err", err)
 			os.Exit(1)
 		}
-		logToFile("Index initialized successfully!\n")
+		slog.Info("Index initialized")
 		return
 	}
 
-	p := tea.NewProgram(initialModel())
-	if _, err := p.Run(); err != nil {
-		logToFile("Error: %v", err)
+	m := initialModel()
+	if stdinIsPiped() {
+		// `make 2>&1 | goof`: the piped text becomes the symptom (or query)
+		input, err := readPipedInput()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "goof: reading stdin: %v\n", err)
+			os.Exit(1)
+		}
+		// Nothing piped, e.g. `goof < /dev/null`, leaves the menu up
+		if strings.TrimSpace(input) == "" {
+			slog.Debug("Piped input is empty, showing the menu")
+		} else if *searchMode {
+			m = newSearchModel(symptomQuery(input))
+		} else {
+			m = newEntryModel(ErrorReport{
+				Symptom:     input,
+				Environment: CurrentEnvironment(),
+				Resources:   []string{},
+				Date:        time.Now(),
+			})
+		}
+	}
+
+	if err := runTUI(m); err != nil {
+		slog.Error("TUI failed", "err", err)
 		os.Exit(1)
 	}
 }
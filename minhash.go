@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	shingleSize = 3 // Words per shingle
+	lshBands    = 32
+	lshRows     = 4
+	numHashes   = lshBands * lshRows
+
+	// relatedThreshold is the lowest estimated similarity worth showing
+	relatedThreshold = 0.3
+	maxRelated       = 5
+)
+
+// minHashSeeds gives each of the numHashes hash functions its own seed
+var minHashSeeds = func() []uint64 {
+	seeds := make([]uint64, numHashes)
+	state := uint64(0x9e3779b97f4a7c15)
+	for i := range seeds {
+		state = splitMix64(state)
+		seeds[i] = state
+	}
+	return seeds
+}()
+
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// symptomShingles splits a normalized symptom into overlapping word triples
+func symptomShingles(symptom string) []string {
+	words := strings.FieldsFunc(strings.ToLower(NormalizeSymptom(symptom)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '<' && r != '>'
+	})
+	if len(words) == 0 {
+		return nil
+	}
+	if len(words) < shingleSize {
+		return []string{strings.Join(words, " ")}
+	}
+
+	shingles := make([]string, 0, len(words)-shingleSize+1)
+	for i := 0; i+shingleSize <= len(words); i++ {
+		shingles = append(shingles, strings.Join(words[i:i+shingleSize], " "))
+	}
+	return shingles
+}
+
+// MinHashSignature summarizes a symptom so that the share of equal positions
+// in two signatures estimates the Jaccard similarity of their shingles
+func MinHashSignature(symptom string) []uint64 {
+	shingles := symptomShingles(symptom)
+	if len(shingles) == 0 {
+		return nil
+	}
+
+	signature := make([]uint64, numHashes)
+	for i := range signature {
+		signature[i] = ^uint64(0)
+	}
+	for _, shingle := range shingles {
+		h := fnv.New64a()
+		h.Write([]byte(shingle))
+		base := h.Sum64()
+		for i, seed := range minHashSeeds {
+			if v := splitMix64(base ^ seed); v < signature[i] {
+				signature[i] = v
+			}
+		}
+	}
+	return signature
+}
+
+func signatureSimilarity(a, b []uint64) float64 {
+	if len(a) != numHashes || len(b) != numHashes {
+		return 0
+	}
+	equal := 0
+	for i := range a {
+		if a[i] == b[i] {
+			equal++
+		}
+	}
+	return float64(equal) / numHashes
+}
+
+// similarityEntry is what the local index remembers about a report
+type similarityEntry struct {
+	ID        string   `json:"id"`
+	Program   string   `json:"program"`
+	Summary   string   `json:"summary"`
+	Signature []uint64 `json:"signature"`
+}
+
+// relatedReport is a possible near-duplicate of the symptom being typed
+type relatedReport struct {
+	similarityEntry
+	Score float64
+}
+
+// similarityIndex is a locality-sensitive hash index over report signatures:
+// reports sharing any band of lshRows signature values land in the same
+// bucket, so only those candidates need comparing
+type similarityIndex struct {
+	Entries map[string]*similarityEntry `json:"entries"`
+	buckets map[string][]string
+}
+
+func newSimilarityIndex() *similarityIndex {
+	return &similarityIndex{
+		Entries: map[string]*similarityEntry{},
+		buckets: map[string][]string{},
+	}
+}
+
+func bandKeys(signature []uint64) []string {
+	keys := make([]string, 0, lshBands)
+	buf := make([]byte, 8*lshRows)
+	for band := 0; band < lshBands; band++ {
+		for row := 0; row < lshRows; row++ {
+			binary.LittleEndian.PutUint64(buf[row*8:], signature[band*lshRows+row])
+		}
+		h := fnv.New64a()
+		h.Write(buf)
+		keys = append(keys, fmt.Sprintf("%d:%x", band, h.Sum64()))
+	}
+	return keys
+}
+
+// Add indexes a report, replacing any earlier entry with the same ID
+func (idx *similarityIndex) Add(report ErrorReport) {
+	signature := MinHashSignature(report.Symptom)
+	if report.ID == "" || signature == nil {
+		return
+	}
+	idx.Remove(report.ID)
+
+	entry := &similarityEntry{
+		ID:        report.ID,
+		Program:   report.Program,
+		Summary:   reportSummary(report),
+		Signature: signature,
+	}
+	idx.Entries[entry.ID] = entry
+	for _, key := range bandKeys(signature) {
+		idx.buckets[key] = append(idx.buckets[key], entry.ID)
+	}
+}
+
+func (idx *similarityIndex) Remove(id string) {
+	entry, ok := idx.Entries[id]
+	if !ok {
+		return
+	}
+	delete(idx.Entries, id)
+	for _, key := range bandKeys(entry.Signature) {
+		ids := idx.buckets[key]
+		for i, other := range ids {
+			if other == id {
+				idx.buckets[key] = append(ids[:i], ids[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Related returns the indexed reports most similar to symptom
+func (idx *similarityIndex) Related(symptom string) []relatedReport {
+	signature := MinHashSignature(symptom)
+	if idx == nil || signature == nil {
+		return nil
+	}
+
+	candidates := map[string]bool{}
+	for _, key := range bandKeys(signature) {
+		for _, id := range idx.buckets[key] {
+			candidates[id] = true
+		}
+	}
+
+	var related []relatedReport
+	for id := range candidates {
+		entry := idx.Entries[id]
+		if score := signatureSimilarity(signature, entry.Signature); score >= relatedThreshold {
+			related = append(related, relatedReport{*entry, score})
+		}
+	}
+	sort.Slice(related, func(i, j int) bool {
+		if related[i].Score != related[j].Score {
+			return related[i].Score > related[j].Score
+		}
+		return related[i].ID < related[j].ID
+	})
+	if len(related) > maxRelated {
+		related = related[:maxRelated]
+	}
+	return related
+}
+
+// similarityIndexPath is where the index is cached between runs, one file
+// per Meilisearch index
+func similarityIndexPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "goof", LoadConfig().IndexName+"-similarity.json"), nil
+}
+
+// loadSimilarityIndex reads the cached index, returning an empty one if
+// there is no usable cache
+func loadSimilarityIndex() *similarityIndex {
+	idx := newSimilarityIndex()
+
+	path, err := similarityIndexPath()
+	if err != nil {
+		return idx
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return idx
+	}
+
+	var cached similarityIndex
+	if err := json.Unmarshal(data, &cached); err != nil {
+		slog.Warn("Ignoring unreadable similarity index", "path", path, "err", err)
+		return idx
+	}
+	for _, entry := range cached.Entries {
+		if len(entry.Signature) != numHashes {
+			continue
+		}
+		idx.Entries[entry.ID] = entry
+		for _, key := range bandKeys(entry.Signature) {
+			idx.buckets[key] = append(idx.buckets[key], entry.ID)
+		}
+	}
+	return idx
+}
+
+func (idx *similarityIndex) Save() error {
+	path, err := similarityIndexPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// rebuildSimilarityIndex indexes every report on the server and caches the
+// result locally
+func rebuildSimilarityIndex() (*similarityIndex, error) {
+	reports, err := AllErrorReports()
+	if err != nil {
+		return nil, err
+	}
+
+	idx := newSimilarityIndex()
+	for _, report := range reports {
+		idx.Add(report)
+	}
+	if err := idx.Save(); err != nil {
+		slog.Error("Failed to cache similarity index", "err", err)
+	}
+	return idx, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// normalizeRule rewrites one kind of volatile detail in error text, such as
+// a temp file name or a line number, into a stable placeholder
+type normalizeRule struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// normalizeRules are applied in order; later rules see the output of earlier
+// ones, so the more specific patterns (timestamps, temp files) come first
+var normalizeRules = []normalizeRule{
+	{"timestamp", regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<time>"},
+	{"clock", regexp.MustCompile(`\b\d{2}:\d{2}:\d{2}(\.\d+)?\b`), "<time>"},
+	{"uuid", regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{"temp-file", regexp.MustCompile(`(?:/tmp|/var/tmp|/private/var/folders|/var/folders)/[^\s:'"()]+`), "<tmpfile>"},
+	{"hex-address", regexp.MustCompile(`\b0x[0-9a-fA-F]+\b`), "<addr>"},
+	{"path", regexp.MustCompile(`(?:~|\.{1,2})?/?(?:[\w.@+-]+/)+([\w.@+-]+)`), "$1"},
+	{"line-column", regexp.MustCompile(`:\d+(:\d+)?\b`), ":<n>"},
+	{"line-word", regexp.MustCompile(`(?i)\bline \d+\b`), "line <n>"},
+	{"pid", regexp.MustCompile(`(?i)\b(pid|process)([ =:#]*)\d+\b`), "$1$2<n>"},
+	{"bracketed-number", regexp.MustCompile(`\[\d+\]`), "[<n>]"},
+}
+
+// normalizeConfig is the [normalize] table of the config file
+type normalizeConfig struct {
+	Rules []normalizeRuleConfig `toml:"rules"`
+}
+
+// normalizeRuleConfig is a [[normalize.rules]] entry, for project-specific
+// noise like build numbers. It runs after the built-in rules.
+type normalizeRuleConfig struct {
+	Name        string `toml:"name"`
+	Pattern     string `toml:"pattern"`
+	Replacement string `toml:"replacement"`
+}
+
+// fingerprintVersion changes whenever the built-in rules or the way the hash
+// is taken do, so fingerprints made the old way never match new ones
+const fingerprintVersion = "v1"
+
+var (
+	loadNormalizeRulesOnce sync.Once
+	configuredRules        []normalizeRule
+	configuredRulesHash    string // Identifies the configured rules in fingerprints
+)
+
+// configuredNormalizeRules compiles the config file's rules once per run,
+// skipping invalid ones
+func configuredNormalizeRules() ([]normalizeRule, string) {
+	loadNormalizeRulesOnce.Do(func() {
+		file, _ := readConfigFile()
+		if len(file.Normalize.Rules) == 0 {
+			return
+		}
+		hash := sha256.New()
+		for _, rule := range file.Normalize.Rules {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				slog.Warn("Skipping normalize rule with an invalid pattern", "rule", rule.Name, "err", err)
+				continue
+			}
+			configuredRules = append(configuredRules, normalizeRule{firstSet(rule.Name, "custom"), pattern, rule.Replacement})
+			hash.Write([]byte(rule.Pattern + "\x00" + rule.Replacement + "\x00"))
+		}
+		if len(configuredRules) > 0 {
+			configuredRulesHash = hex.EncodeToString(hash.Sum(nil)[:4])
+		}
+	})
+	return configuredRules, configuredRulesHash
+}
+
+// NormalizeSymptom canonicalizes error text so the same error from different
+// machines, directories or runs reads the same
+func NormalizeSymptom(text string) string {
+	custom, _ := configuredNormalizeRules()
+	rules := append(normalizeRules[:len(normalizeRules):len(normalizeRules)], custom...)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		for _, rule := range rules {
+			line = rule.pattern.ReplaceAllString(line, rule.replacement)
+		}
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Fingerprint identifies a symptom by its normalized error lines, so the
+// surrounding build noise doesn't change it. It starts with the version, and
+// with a hash of the configured rules when there are any, e.g.
+// "v1:1f0c…" or "v1+9a3b2c1d:1f0c…": fingerprints only match when they were
+// made the same way. A report made before then is still found by the fuzzy
+// search, and saving it again (e.g. `goof edit <id>` with no flags) gives it
+// a current fingerprint.
+func Fingerprint(symptom string) string {
+	normalized := NormalizeSymptom(extractErrorText(symptom))
+	if normalized == "" {
+		return ""
+	}
+	version := fingerprintVersion
+	if _, rulesHash := configuredNormalizeRules(); rulesHash != "" {
+		version += "+" + rulesHash
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return version + ":" + hex.EncodeToString(sum[:16])
+}
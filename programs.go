@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// builtinProgramAliases maps the names a program shows up under (drivers,
+// versioned binaries, distro renames) to one canonical name
+var builtinProgramAliases = map[string]string{
+	"cc":         "gcc",
+	"cc1":        "gcc",
+	"cc1plus":    "gcc",
+	"collect2":   "gcc",
+	"g++":        "gcc",
+	"c++":        "gcc",
+	"gnu cc":     "gcc",
+	"clang++":    "clang",
+	"clang-cl":   "clang",
+	"ld.bfd":     "ld",
+	"ld.gold":    "ld",
+	"ld.lld":     "ld",
+	"lld":        "ld",
+	"gold":       "ld",
+	"mold":       "ld",
+	"golang":     "go",
+	"python3":    "python",
+	"cpython":    "python",
+	"nodejs":     "node",
+	"node.js":    "node",
+	"apt-get":    "apt",
+	"apt-cache":  "apt",
+	"yum":        "dnf",
+	"pip3":       "pip",
+	"gmake":      "make",
+	"cmake3":     "cmake",
+	"pkgconf":    "pkg-config",
+	"javac":      "java",
+	"openjdk":    "java",
+	"rust":       "rustc",
+	"powershell": "pwsh",
+}
+
+var (
+	// gcc-13, python3.11, clang-17
+	programVersionSuffix = regexp.MustCompile(`[-_ ]?v?\d+(\.\d+)*$`)
+	// x86_64-linux-gnu-gcc, aarch64-none-elf-ld
+	programTargetPrefix = regexp.MustCompile(`^[\w]+-(?:[\w]+-)*(?:linux|gnu|elf|eabi|eabihf|mingw32|darwin\d*|w64|apple|pc|unknown|none)-`)
+	// "make[2]:", "/usr/bin/ld:", "cc1plus:" at the start of a line
+	programLinePrefix = regexp.MustCompile(`(?m)^(?:\S*/)?([A-Za-z][\w.+-]*)(?:\[\d+\])?: `)
+)
+
+// programRule recognizes a program from a distinctive line in its output
+type programRule struct {
+	program string
+	pattern *regexp.Regexp
+}
+
+var programRules = []programRule{
+	{"npm", regexp.MustCompile(`(?m)^npm (ERR!|error) `)},
+	{"make", regexp.MustCompile(`(?m)^g?make(\[\d+\])?: \*\*\*`)},
+	{"cargo", regexp.MustCompile(`(?m)^error: could not compile `)},
+	{"rustc", regexp.MustCompile(`(?m)^error: linking with `)},
+	{"cmake", regexp.MustCompile(`(?m)^CMake (Error|Warning)`)},
+	{"apt", regexp.MustCompile(`(?m)^E: (Unable to locate package|Unmet dependencies|Package .* has no installation candidate)`)},
+	{"pacman", regexp.MustCompile(`(?m)^error: failed to (prepare|commit) transaction`)},
+	{"dnf", regexp.MustCompile(`(?m)^Error: \n? ?Problem`)},
+	{"docker", regexp.MustCompile(`(?m)^(ERROR: failed to solve|Error response from daemon)`)},
+}
+
+// recognizerPrograms maps the error recognizers that identify a program on
+// their own to that program
+var recognizerPrograms = map[string]string{
+	"apt":        "apt",
+	"dnf":        "dnf",
+	"pacman":     "pacman",
+	"pip":        "pip",
+	"cmake":      "cmake",
+	"pkg-config": "pkg-config",
+	"ld":         "ld",
+}
+
+// cleanProgramName lowercases a program name and strips its version and
+// cross-compiler target, without looking it up
+func cleanProgramName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = filepath.Base(name)
+	if name == "." || name == "/" {
+		return ""
+	}
+	name = programTargetPrefix.ReplaceAllString(name, "")
+	if stripped := programVersionSuffix.ReplaceAllString(name, ""); stripped != "" {
+		name = stripped
+	}
+	return name
+}
+
+// CanonicalProgram maps any spelling of a program ("GCC", "gcc-13",
+// "cc1plus") to its canonical name, consulting learned aliases first
+func CanonicalProgram(name string) string {
+	if strings.TrimSpace(name) == "" {
+		return ""
+	}
+	learned := loadLearnedAliases()
+	for _, candidate := range []string{strings.ToLower(strings.TrimSpace(name)), cleanProgramName(name)} {
+		if canonical, ok := learned[candidate]; ok {
+			return canonical
+		}
+		if canonical, ok := builtinProgramAliases[candidate]; ok {
+			return canonical
+		}
+	}
+	return cleanProgramName(name)
+}
+
+// ProgramAliases lists every known name of a canonical program, including
+// the canonical name itself, for expanding searches
+func ProgramAliases(canonical string) []string {
+	names := map[string]bool{canonical: true}
+	for alias, target := range builtinProgramAliases {
+		if target == canonical {
+			names[alias] = true
+		}
+	}
+	for alias, target := range loadLearnedAliases() {
+		if target == canonical {
+			names[alias] = true
+		}
+	}
+
+	aliases := make([]string, 0, len(names))
+	for name := range names {
+		aliases = append(aliases, name)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// isKnownProgram reports whether a canonical name has aliases worth
+// expanding a search to
+func isKnownProgram(canonical string) bool {
+	return len(ProgramAliases(canonical)) > 1
+}
+
+// DetectProgram infers the canonical program that produced a symptom from
+// its shape: tracebacks and package manager errors first since they are
+// unambiguous, then compiler diagnostics, then distinctive lines, and finally
+// whatever names itself at the start of a line
+func DetectProgram(symptom string) string {
+	if traceback := ParseTraceback(symptom); traceback != nil {
+		return traceback.Program
+	}
+
+	extracted := RecognizeErrors(symptom)
+	for _, recognizer := range extracted[extractedRecognizer] {
+		if program, ok := recognizerPrograms[recognizer]; ok {
+			return program
+		}
+	}
+
+	if compiler, _ := ParseDiagnostics(symptom); compiler != "" {
+		return compiler
+	}
+
+	for _, rule := range programRules {
+		if rule.pattern.MatchString(symptom) {
+			return rule.program
+		}
+	}
+
+	if raw := rawProgramToken(symptom); raw != "" {
+		if canonical := CanonicalProgram(raw); canonical != cleanProgramName(raw) || isKnownProgram(canonical) {
+			return canonical
+		}
+	}
+	return ""
+}
+
+// rawProgramToken returns the program name a symptom's first error line
+// starts with, e.g. "cc1plus" for "cc1plus: error: ..."
+func rawProgramToken(symptom string) string {
+	m := programLinePrefix.FindStringSubmatch(extractErrorText(symptom))
+	if m == nil || m[1] == "error" || m[1] == "warning" || m[1] == "fatal" || m[1] == "note" {
+		return ""
+	}
+	return m[1]
+}
+
+// learnProgramAlias remembers that the tool a symptom names itself as is an
+// alias of the program the user filed it under, so the next symptom from
+// that tool is detected correctly
+func learnProgramAlias(symptom, program string) {
+	raw := strings.ToLower(rawProgramToken(symptom))
+	canonical := CanonicalProgram(program)
+	if raw == "" || canonical == "" || raw == canonical || CanonicalProgram(raw) != cleanProgramName(raw) {
+		return
+	}
+	if isKnownProgram(cleanProgramName(raw)) {
+		// Already a program in its own right, like "ld" under a gcc report
+		return
+	}
+
+	learned := loadLearnedAliases()
+	if learned[raw] == canonical {
+		return
+	}
+	learned[raw] = canonical
+	if err := saveLearnedAliases(learned); err != nil {
+		slog.Error("Failed to save learned program aliases", "err", err)
+	}
+}
+
+// learnedAliasesPath is where learned aliases are kept,
+// $XDG_DATA_HOME/goof/program-aliases.json
+func learnedAliasesPath() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "goof", "program-aliases.json")
+}
+
+func loadLearnedAliases() map[string]string {
+	learned := map[string]string{}
+	path := learnedAliasesPath()
+	if path == "" {
+		return learned
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return learned
+	}
+	if err := json.Unmarshal(data, &learned); err != nil {
+		slog.Warn("Ignoring unreadable program aliases", "path", path, "err", err)
+		return map[string]string{}
+	}
+	return learned
+}
+
+func saveLearnedAliases(learned map[string]string) error {
+	path := learnedAliasesPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(learned, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Keys of ErrorReport.Extracted
+const (
+	extractedRecognizer = "recognizer" // Which recognizers matched, e.g. "apt", "ld"
+	extractedPackages   = "packages"
+	extractedSymbols    = "symbols"
+	extractedHeaders    = "headers"
+	extractedLibraries  = "libraries"
+)
+
+// extractPattern pulls values for one field out of a matching line. Every
+// capture group is a value; with split set, a group holding a list such as
+// "foo==1.0 and bar==2.0" is broken into its items.
+type extractPattern struct {
+	field   string
+	pattern *regexp.Regexp
+	split   bool
+}
+
+// errorRecognizer knows the error format of one package manager or build tool
+type errorRecognizer struct {
+	name     string
+	patterns []extractPattern
+}
+
+var errorRecognizers = []errorRecognizer{
+	{"apt", []extractPattern{
+		{extractedPackages, regexp.MustCompile(`^\s*(\S+) : (?:Pre)?Depends: (\S+)`), false},
+		{extractedPackages, regexp.MustCompile(`^\s+(?:Pre)?Depends: (\S+)`), false},
+		{extractedPackages, regexp.MustCompile(`^E: Unable to locate package (\S+)`), false},
+		{extractedPackages, regexp.MustCompile(`^E: Package '([^']+)' has no installation candidate`), false},
+		{extractedPackages, regexp.MustCompile(`^\s*(\S+) : Breaks: (\S+)`), false},
+	}},
+	{"dnf", []extractPattern{
+		{extractedPackages, regexp.MustCompile(`package (\S+) requires (\S+), but none of the providers can be installed`), false},
+		{extractedPackages, regexp.MustCompile(`nothing provides (\S+) needed by (\S+)`), false},
+		{extractedPackages, regexp.MustCompile(`^No match for argument: (\S+)`), false},
+		{extractedPackages, regexp.MustCompile(`package (\S+) conflicts with (\S+) provided by (\S+)`), false},
+	}},
+	{"pacman", []extractPattern{
+		{extractedPackages, regexp.MustCompile(`^:: installing (\S+) \([^)]*\) breaks dependency '([^']+)' required by (\S+)`), false},
+		{extractedPackages, regexp.MustCompile(`^:: unable to satisfy dependency '([^']+)' required by (\S+)`), false},
+		{extractedPackages, regexp.MustCompile(`^error: target not found: (\S+)`), false},
+		{extractedPackages, regexp.MustCompile(`^:: (\S+) and (\S+) are in conflict`), false},
+	}},
+	{"pip", []extractPattern{
+		{extractedPackages, regexp.MustCompile(`^ERROR: Could not find a version that satisfies the requirement ([^\s(]+)`), false},
+		{extractedPackages, regexp.MustCompile(`^ERROR: No matching distribution found for ([^\s(]+)`), false},
+		{extractedPackages, regexp.MustCompile(`^ERROR: Cannot install (.+?) because these package versions have conflicting dependencies`), true},
+		{extractedPackages, regexp.MustCompile(`^\s+(\S+) \S+ depends on ([^\s<>=!~]+)`), false},
+		{extractedPackages, regexp.MustCompile(`No module named '([^']+)'`), false},
+	}},
+	{"cmake", []extractPattern{
+		{extractedPackages, regexp.MustCompile(`Could NOT find (\w+)`), false},
+		{extractedPackages, regexp.MustCompile(`By not providing "Find(\w+)\.cmake"`), false},
+		{extractedPackages, regexp.MustCompile(`Could not find a package configuration file provided by "(\w+)"`), false},
+	}},
+	{"pkg-config", []extractPattern{
+		{extractedPackages, regexp.MustCompile(`Package (\S+) was not found in the pkg-config search path`), false},
+		{extractedPackages, regexp.MustCompile(`No package '(\S+)' found`), false},
+	}},
+	{"ld", []extractPattern{
+		{extractedSymbols, regexp.MustCompile("undefined reference to [`'‘]([^'’]+)['’]"), false},
+		{extractedSymbols, regexp.MustCompile("multiple definition of [`'‘]([^'’]+)['’]"), false},
+		{extractedSymbols, regexp.MustCompile(`undefined symbol: (\S+)`), false},
+		{extractedSymbols, regexp.MustCompile(`^\s+"([^"]+)", referenced from:`), false},
+		{extractedLibraries, regexp.MustCompile(`cannot find -l(\S+)`), false},
+		{extractedLibraries, regexp.MustCompile(`error while loading shared libraries: ([^:\s]+):`), false},
+	}},
+	{"missing-header", []extractPattern{
+		{extractedHeaders, regexp.MustCompile(`fatal error: ([^:\s]+): No such file or directory`), false},
+		{extractedHeaders, regexp.MustCompile(`fatal error: '([^']+)' file not found`), false},
+	}},
+}
+
+var (
+	listSeparatorPattern = regexp.MustCompile(`,\s*|\s+and\s+`)
+	versionSuffixPattern = regexp.MustCompile(`\s*[(<>=!~].*$`)
+)
+
+// RecognizeErrors runs every recognizer over the text and returns the values
+// they extracted, keyed by field, in the order they first appeared
+func RecognizeErrors(text string) map[string][]string {
+	extracted := map[string][]string{}
+	seen := map[string]bool{}
+	add := func(field, value string) {
+		if field == extractedPackages {
+			value = versionSuffixPattern.ReplaceAllString(strings.Trim(value, `"'`), "")
+		}
+		if value == "" || seen[field+"\x00"+value] {
+			return
+		}
+		seen[field+"\x00"+value] = true
+		extracted[field] = append(extracted[field], value)
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for _, recognizer := range errorRecognizers {
+		matched := false
+		for _, line := range lines {
+			for _, p := range recognizer.patterns {
+				m := p.pattern.FindStringSubmatch(line)
+				if m == nil {
+					continue
+				}
+				matched = true
+				for _, group := range m[1:] {
+					if !p.split {
+						add(p.field, group)
+						continue
+					}
+					for _, item := range listSeparatorPattern.Split(group, -1) {
+						add(p.field, item)
+					}
+				}
+			}
+		}
+		if matched {
+			add(extractedRecognizer, recognizer.name)
+		}
+	}
+
+	return extracted
+}
+
+// formatExtracted renders extracted values as "field: a, b" parts
+func formatExtracted(extracted map[string][]string, sep string) string {
+	fields := make([]string, 0, len(extracted))
+	for field := range extracted {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, field+": "+strings.Join(extracted[field], ", "))
+	}
+	return strings.Join(parts, sep)
+}
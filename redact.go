@@ -0,0 +1,269 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+)
+
+// redactionConfig is the [redaction] table of the config file
+type redactionConfig struct {
+	Disabled        bool                  `toml:"disabled"`         // Turns redaction off altogether
+	Disable         []string              `toml:"disable"`          // Names of built-in detectors to skip
+	InternalDomains []string              `toml:"internal_domains"` // Domains whose hosts and URLs are redacted
+	Rules           []redactionRuleConfig `toml:"rules"`
+}
+
+type redactionRuleConfig struct {
+	Name        string `toml:"name"`
+	Pattern     string `toml:"pattern"`
+	Replacement string `toml:"replacement"` // Defaults to [REDACTED:<name>]
+}
+
+// redactionRule replaces what pattern matches. If the pattern has a group
+// named "secret", only that part is replaced, so `password=hunter2` can keep
+// its `password=`.
+type redactionRule struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// hostEnd ends a host name pattern where no further ".label" follows, so Java
+// packages such as jdk.internal.reflect aren't taken for hosts. It's outside
+// the "secret" group, so what it matches is kept.
+const hostEnd = `(?:$|[^\w.-]|\.(?:$|[^\w-]))`
+
+// builtinRedactionRules detect common credential formats. More specific
+// rules come first, so an AWS key isn't caught by the generic assignment rule.
+var builtinRedactionRules = []redactionRule{
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), ""},
+	{"aws-access-key", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA)[0-9A-Z]{16}\b`), ""},
+	{"aws-secret-key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`), ""},
+	{"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`), ""},
+	{"gitlab-token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`), ""},
+	{"slack-token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`), ""},
+	{"google-api-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`), ""},
+	{"stripe-key", regexp.MustCompile(`\b[sr]k_(?:live|test)_[0-9A-Za-z]{16,}\b`), ""},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`), ""},
+	{"bearer-token", regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/=-]{8,})`), ""},
+	{"url-credentials", regexp.MustCompile(`://[^/:@\s]+:(?P<secret>[^/@\s]+)@`), ""},
+	{"credential-assignment", regexp.MustCompile(`(?i)\b(?:password|passwd|api[_-]?key|access[_-]?key|client[_-]?secret|secret[_-]?key)["']?\s*[:=]\s*["']?(?P<secret>[^\s"',;]{4,})`), ""},
+	// Only with "=", since compilers say things like "expected token: identifier"
+	{"credential-parameter", regexp.MustCompile(`(?i)\b(?:[a-z_]*token|secret)=(?P<secret>[^\s"',;&]{4,})`), ""},
+	{"internal-host", regexp.MustCompile(`(?i)(?P<secret>\b(?:https?://)?(?:[a-z0-9-]+\.)+(?:internal|corp|lan|intranet)\b(?::\d+)?(?:/[^\s"'<>\[]*)?)` + hostEnd), ""},
+}
+
+// redactionFinding is one redaction made to a report, for the preview
+type redactionFinding struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Match string `json:"match"`
+}
+
+type redactor struct {
+	rules []redactionRule
+}
+
+// newRedactor builds the pipeline: the built-in detectors not disabled, the
+// configured internal domains, the configured rules, then this machine's
+// home directory, user name and host name
+func newRedactor(config redactionConfig) redactor {
+	var r redactor
+	if config.Disabled {
+		return r
+	}
+	disabled := func(name string) bool {
+		for _, d := range config.Disable {
+			if d == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, rule := range builtinRedactionRules {
+		if !disabled(rule.name) {
+			r.rules = append(r.rules, rule)
+		}
+	}
+
+	if len(config.InternalDomains) > 0 && !disabled("internal-url") {
+		domains := make([]string, len(config.InternalDomains))
+		for i, domain := range config.InternalDomains {
+			domains[i] = regexp.QuoteMeta(strings.TrimPrefix(domain, "."))
+		}
+		pattern := `(?i)(?P<secret>\b(?:https?://)?(?:[a-z0-9-]+\.)*(?:` + strings.Join(domains, "|") + `)\b(?::\d+)?(?:/[^\s"'<>\[]*)?)` + hostEnd
+		r.rules = append(r.rules, redactionRule{"internal-url", regexp.MustCompile(pattern), ""})
+	}
+
+	for _, rule := range config.Rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			slog.Warn("Skipping redaction rule with an invalid pattern", "rule", rule.Name, "err", err)
+			continue
+		}
+		name := firstSet(rule.Name, "custom")
+		r.rules = append(r.rules, redactionRule{name, pattern, rule.Replacement})
+	}
+
+	if !disabled("home") {
+		if home, err := os.UserHomeDir(); err == nil && len(home) > 1 {
+			// First, so the user rules see ~ rather than the home directory
+			r.rules = append([]redactionRule{homeRule(home)}, r.rules...)
+		}
+	}
+	if current, err := user.Current(); err == nil && !disabled("user") {
+		r.rules = append(r.rules, userRules(current.Username)...)
+	}
+	if hostname, err := os.Hostname(); err == nil && !disabled("hostname") {
+		r.rules = append(r.rules, hostnameRules(hostname)...)
+	}
+	return r
+}
+
+// homeRule shows the home directory as ~, where it's a whole path component:
+// /home/al is left alone in /home/alice
+func homeRule(home string) redactionRule {
+	home = strings.TrimRight(home, `/\`)
+	return redactionRule{"home", regexp.MustCompile(`(?P<secret>` + regexp.QuoteMeta(home) + `)(?:$|[/\\\s"'\x60:;,)\]])`), "~"}
+}
+
+// userRules match the login name where it names this user: in a home
+// directory, as ~user or as user@host. Elsewhere a login such as "build" or
+// "dev" is just as likely to be an ordinary word in the output.
+func userRules(username string) []redactionRule {
+	// Windows user names come as DOMAIN\user; the user part is what shows up in paths
+	if _, rest, ok := strings.Cut(username, `\`); ok {
+		username = rest
+	}
+	if username == "" || username == "root" {
+		return nil
+	}
+	name := regexp.QuoteMeta(username)
+	return []redactionRule{
+		{"user", regexp.MustCompile(`(?i)(?:/home/|/Users/|/var/home/|\\Users\\)(?P<secret>` + name + `)\b`), ""},
+		{"user", regexp.MustCompile(`(?i)(?:^|[\s"'=:(\[])~(?P<secret>` + name + `)\b`), ""},
+		{"user", regexp.MustCompile(`(?i)(?:^|[^\w.@-])(?P<secret>` + name + `)@[A-Za-z0-9]`), ""},
+	}
+}
+
+// hostnameRules match the host name where it names this machine: after
+// user@, at the start of a shell prompt, and as a fully qualified name. A bare
+// "ubuntu" or "fedora" elsewhere is more likely a distro than the host.
+func hostnameRules(hostname string) []redactionRule {
+	if hostname == "" || strings.EqualFold(hostname, "localhost") {
+		return nil
+	}
+	var rules []redactionRule
+	short, _, qualified := strings.Cut(hostname, ".")
+	if qualified {
+		// Before the others, which would only take its first label
+		rules = append(rules, redactionRule{"hostname", regexp.MustCompile(`(?i)\b(?P<secret>` + regexp.QuoteMeta(hostname) + `)` + hostEnd), ""})
+	}
+	name := regexp.QuoteMeta(short)
+	return append(rules,
+		redactionRule{"hostname", regexp.MustCompile(`(?i)[\w.-]@(?P<secret>` + name + `)(?:$|[^\w-])`), ""},
+		redactionRule{"hostname", regexp.MustCompile(`(?im)^(?P<secret>` + name + `)(?::[~/]|\s*[$#%>](?:\s|$))`), ""},
+	)
+}
+
+// redact returns text with every rule applied, and what each one replaced
+func (r redactor) redact(text string) (string, []redactionFinding) {
+	var findings []redactionFinding
+	for _, rule := range r.rules {
+		replacement := firstSet(rule.replacement, "[REDACTED:"+rule.name+"]")
+		secret := rule.pattern.SubexpIndex("secret")
+
+		var b strings.Builder
+		last, replaced := 0, false
+		for _, m := range rule.pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if secret > 0 && m[2*secret] >= 0 {
+				start, end = m[2*secret], m[2*secret+1]
+			}
+			// Leave what an earlier rule already redacted alone
+			if strings.HasPrefix(text[start:end], "[REDACTED") || start < last {
+				continue
+			}
+			b.WriteString(text[last:start])
+			b.WriteString(replacement)
+			findings = append(findings, redactionFinding{Rule: rule.name, Match: text[start:end]})
+			last, replaced = end, true
+		}
+		if replaced {
+			b.WriteString(text[last:])
+			text = b.String()
+		}
+	}
+	return text, findings
+}
+
+// redactReport runs the redaction pipeline over the report's free-text
+// fields and environment values, returning the redacted report and what was
+// redacted. A solution that will be encrypted is left alone: only those with
+// the key can read it, and the internal hosts and credentials in it are
+// often the point of the solution.
+func redactReport(report ErrorReport, config redactionConfig, encryptSolution bool) (ErrorReport, []redactionFinding) {
+	r := newRedactor(config)
+	var findings []redactionFinding
+	apply := func(field, text string) string {
+		redacted, found := r.redact(text)
+		for _, finding := range found {
+			finding.Field = field
+			findings = append(findings, finding)
+		}
+		return redacted
+	}
+
+	report.Symptom = apply("Symptom", report.Symptom)
+	if !encryptSolution {
+		report.Solution = apply("Solution", report.Solution)
+	}
+	if len(report.Environment) > 0 {
+		// LD_LIBRARY_PATH, CFLAGS and the like often hold the home directory
+		environment := make(map[string]string, len(report.Environment))
+		for key, value := range report.Environment {
+			environment[key] = apply("Environment", value)
+		}
+		report.Environment = environment
+	}
+	if len(report.Resources) > 0 {
+		resources := make([]string, len(report.Resources))
+		for i, resource := range report.Resources {
+			resources[i] = apply("Resources", resource)
+		}
+		report.Resources = resources
+	}
+	return report, findings
+}
+
+// previewRedactions lists what saving the report would redact, each
+// finding once, with the matches masked for showing on screen
+func previewRedactions(report ErrorReport, config Config) []redactionFinding {
+	_, findings := redactReport(report, config.Redaction, config.EncryptionKey != "")
+	seen := map[redactionFinding]bool{}
+	var preview []redactionFinding
+	for _, finding := range findings {
+		if seen[finding] {
+			continue
+		}
+		seen[finding] = true
+		finding.Match = maskForPreview(finding.Match)
+		preview = append(preview, finding)
+	}
+	return preview
+}
+
+// maskForPreview shows enough of a redacted value to recognize it without
+// putting the whole secret back on screen
+func maskForPreview(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	runes := []rune(value)
+	if len(runes) <= 8 {
+		return value
+	}
+	return string(runes[:4]) + "…" + string(runes[len(runes)-2:])
+}
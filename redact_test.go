@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestRedactorRules(t *testing.T) {
+	const javaFrames = "Exception in thread \"main\" java.lang.IllegalStateException: boom\n" +
+		"\tat jdk.internal.reflect.DirectMethodHandleAccessor.invoke(DirectMethodHandleAccessor.java:103)\n" +
+		"\tat com.example.corp.Service.run(Service.java:12)"
+
+	tests := []struct {
+		name  string
+		rules []redactionRule
+		in    string
+		want  string
+	}{
+		{"jdk frames", builtinRedactionRules, javaFrames, javaFrames},
+		{"bare internal host", builtinRedactionRules, "connecting to build.corp failed", "connecting to [REDACTED:internal-host] failed"},
+		{"internal host ending a sentence", builtinRedactionRules, "mirror is ci.lan.", "mirror is [REDACTED:internal-host]."},
+		{"internal host with a port", builtinRedactionRules, "dial db.internal:5432: refused", "dial [REDACTED:internal-host]: refused"},
+		{"internal URL", builtinRedactionRules, "see http://wiki.corp/Build_Errors.", "see [REDACTED:internal-host]"},
+
+		{"home directory", []redactionRule{homeRule("/home/al")}, "/home/al/src/x.c:3: error", "~/src/x.c:3: error"},
+		{"home directory alone", []redactionRule{homeRule("/home/al")}, "cd /home/al", "cd ~"},
+		{"another user's home", []redactionRule{homeRule("/home/al")}, "/home/alice/src/x.c", "/home/alice/src/x.c"},
+
+		{"user in a path", userRules("build"), "cd /home/build/src", "cd /home/[REDACTED:user]/src"},
+		{"user as a word", userRules("build"), "build/foo.o: No such file", "build/foo.o: No such file"},
+		{"user@host", userRules("build"), "ssh build@ci", "ssh [REDACTED:user]@ci"},
+
+		{"hostname as a distro", hostnameRules("ubuntu"), "Distro: Ubuntu 24.04, see ubuntu.com", "Distro: Ubuntu 24.04, see ubuntu.com"},
+		{"hostname after user@", hostnameRules("ubuntu"), "[me@ubuntu src]$ make", "[me@[REDACTED:hostname] src]$ make"},
+		{"hostname in a prompt", hostnameRules("ubuntu"), "ubuntu:~/src$ make", "[REDACTED:hostname]:~/src$ make"},
+		{"fully qualified hostname", hostnameRules("build7.example.com"), "build7.example.com: connection refused", "[REDACTED:hostname]: connection refused"},
+		{"fully qualified hostname after user@", hostnameRules("build7.example.com"), "me@build7.example.com", "me@[REDACTED:hostname]"},
+		{"localhost", hostnameRules("localhost"), "connect to localhost:80", "connect to localhost:80"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _ := redactor{test.rules}.redact(test.in)
+			if got != test.want {
+				t.Errorf("redact(%q) = %q, want %q", test.in, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// errorLinePattern picks out the lines of a command's stderr that are most
+// likely to describe what went wrong
+var errorLinePattern = regexp.MustCompile(`(?i)\b(error|fatal|undefined reference|panic|exception|traceback|failed|cannot|not found)\b`)
+
+const (
+	maxErrorLines    = 20 // Lines of stderr kept when extracting the error
+	maxSolutionLines = 6  // Lines of each solution printed inline
+)
+
+func runRunCommand(args []string) int {
+	fs := newFlagSet("run")
+	limit := fs.Int("limit", 3, "Number of matching solutions to print")
+	noPrompt := fs.Bool("no-prompt", false, "Don't offer to record a new report after a failure")
+
+	// Stop at the first positional argument so the wrapped command's own
+	// flags are left alone: `goof run make -j8` and `goof run -- make -j8`
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: goof run [flags] -- <command> [args...]")
+		return exitError
+	}
+	argv := fs.Args()
+
+	var captured bytes.Buffer
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &captured)
+
+	err := cmd.Run()
+	if err == nil {
+		return exitOK
+	}
+
+	exitCode := 1
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		// The command never started, so there is nothing to look up
+		fmt.Fprintf(os.Stderr, "goof run: %v\n", err)
+		return 127
+	}
+	if exitErr.ExitCode() > 0 {
+		exitCode = exitErr.ExitCode()
+	}
+
+	output := strings.TrimSpace(captured.String())
+	errorText := extractErrorText(output)
+
+	fmt.Fprintf(os.Stderr, "\ngoof: `%s` exited with status %d\n", strings.Join(argv, " "), exitCode)
+
+	if errorText != "" {
+		reports, err := FindReportsForSymptom(output, Filter{
+			PreferEnvironment: CurrentEnvironment(),
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "goof: search failed: %v\n", err)
+		} else {
+			printKnownSolutions(os.Stderr, reports, *limit)
+		}
+	}
+
+	if !*noPrompt && term.IsTerminal(os.Stdin.Fd()) && promptKey("Press n to record a new report, any other key to exit: ") == 'n' {
+		if output == "" {
+			output = errorText
+		}
+		if err := runTUI(newEntryModel(newRunReport(argv, output))); err != nil {
+			fmt.Fprintf(os.Stderr, "goof run: %v\n", err)
+		}
+	}
+
+	return exitCode
+}
+
+// newRunReport is the report offered for a failed command, with the program
+// and a normalized symptom filled in from its output
+func newRunReport(argv []string, output string) ErrorReport {
+	program := DetectProgram(output)
+	if program == "" {
+		program = CanonicalProgram(filepath.Base(argv[0]))
+	}
+	symptom, _ := normalizeTracebackSymptom(output)
+	return ErrorReport{
+		Symptom:     symptom,
+		Program:     program,
+		Environment: CurrentEnvironment(),
+		Resources:   []string{},
+		Date:        time.Now(),
+	}
+}
+
+// extractErrorText keeps the lines of output that look like errors, falling
+// back to the tail of the output when none do
+func extractErrorText(output string) string {
+	var lines, matches []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, line)
+		if errorLinePattern.MatchString(line) {
+			matches = append(matches, line)
+		}
+	}
+
+	if len(matches) == 0 {
+		matches = lines
+		if len(matches) > maxErrorLines {
+			matches = matches[len(matches)-maxErrorLines:]
+		}
+	} else if len(matches) > maxErrorLines {
+		matches = matches[:maxErrorLines]
+	}
+
+	return strings.Join(matches, "\n")
+}
+
+func printKnownSolutions(w io.Writer, reports []ErrorReport, limit int) {
+	if len(reports) == 0 {
+		fmt.Fprintln(w, "goof: no matching reports in the knowledge base")
+		return
+	}
+	if len(reports) > limit {
+		reports = reports[:limit]
+	}
+
+	fmt.Fprintf(w, "goof: %d matching report(s):\n", len(reports))
+	for i, report := range reports {
+		fmt.Fprintf(w, "\n[%d] %s - %s (%s)\n", i+1, report.Program, reportSummary(report), report.ID)
+
+		solution := strings.Split(strings.TrimSpace(report.Solution), "\n")
+		if len(solution) > maxSolutionLines {
+			solution = append(solution[:maxSolutionLines], "...")
+		}
+		for _, line := range solution {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// promptKey prints a prompt and waits for a single keypress on stdin
+func promptKey(prompt string) byte {
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	state, err := term.MakeRaw(os.Stdin.Fd())
+	if err != nil {
+		return 0
+	}
+	defer term.Restore(os.Stdin.Fd(), state)
+
+	var buf [1]byte
+	if _, err := os.Stdin.Read(buf[:]); err != nil {
+		return 0
+	}
+	return buf[0]
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Secret holds a credential such as the Meilisearch key. It prints masked
+// however it's formatted, so only Reveal gets at the value.
+type Secret string
+
+const redacted = "[REDACTED]"
+
+// Reveal returns the secret itself, for handing to the client that needs it
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+var (
+	secretsMu sync.Mutex
+	secrets   []string
+)
+
+// Patterns for credentials that may reach a log without going through a
+// Secret, e.g. in an error message quoting a request
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`(?i)(authorization:\s*)\S+`),
+	regexp.MustCompile(`(://[^/:@\s]+:)[^/@\s]+(@)`),
+}
+
+// registerSecret makes redactSecrets scrub the secret's value wherever it
+// turns up. Very short values are skipped, since scrubbing them would mangle
+// ordinary text.
+func registerSecret(s Secret) {
+	if len(s) < 4 {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, known := range secrets {
+		if known == string(s) {
+			return
+		}
+	}
+	secrets = append(secrets, string(s))
+}
+
+// redactSecrets replaces registered secrets and anything that looks like a
+// credential in text
+func redactSecrets(text string) string {
+	secretsMu.Lock()
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, redacted)
+	}
+	secretsMu.Unlock()
+
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllString(text, "${1}"+redacted+"${2}")
+	}
+	return text
+}
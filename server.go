@@ -0,0 +1,495 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// serveConfig is the [serve] table of the config file
+type serveConfig struct {
+	Listen string           `toml:"listen"` // Address to listen on, e.g. "127.0.0.1:7780"
+	Tokens []apiTokenConfig `toml:"tokens"`
+}
+
+// apiTokenConfig is one API token. Only its SHA-256 is kept, so the config
+// file doesn't hold anything that grants access.
+type apiTokenConfig struct {
+	Name     string `toml:"name"`
+	SHA256   string `toml:"sha256"`
+	ReadOnly bool   `toml:"read_only"` // May only list, search, get and preview reports
+}
+
+// maxRequestBody caps the size of a report sent to the API
+const maxRequestBody = 1 << 20
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// apiError is the body of every error response
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type server struct {
+	tokens []apiTokenConfig
+	noAuth bool
+	// Writes are serialized, since the file store and the learned program
+	// aliases are rewritten whole
+	writeMu sync.Mutex
+}
+
+func runServeCommand(args []string) int {
+	fs := newFlagSet("serve")
+	config := LoadConfig()
+	listen := fs.String("listen", firstSet(config.Serve.Listen, "127.0.0.1:7780"), "Address to listen on")
+	noAuth := fs.Bool("no-auth", false, "Serve without API tokens, letting anyone who can connect read and write reports")
+	newToken := fs.String("new-token", "", "Create an API token with this name, print it and the config to add, and exit")
+	readOnly := fs.Bool("read-only", false, "With -new-token, only allow the token to list, search and get reports")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return parseExitCode(err)
+	}
+	if len(positional) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: goof serve [-listen addr] [-no-auth] | goof serve -new-token name [-read-only]")
+		return exitError
+	}
+
+	if *newToken != "" {
+		return printNewAPIToken(*newToken, *readOnly)
+	}
+	if len(config.Serve.Tokens) == 0 && !*noAuth {
+		fmt.Fprintln(os.Stderr, "goof serve: no API tokens configured; create one with goof serve -new-token <name>, or pass -no-auth")
+		return exitError
+	}
+
+	s := &server{tokens: config.Serve.Tokens, noAuth: *noAuth}
+	httpServer := &http.Server{
+		Addr:              *listen,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	if *noAuth {
+		fmt.Fprintln(os.Stderr, "goof serve: warning: serving without authentication")
+	}
+	fmt.Printf("Serving the %s store of profile %s on http://%s/ (API under /api/v1/)\n", config.Backend, profileOrDefault(config), *listen)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "goof serve: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// printNewAPIToken generates a token and prints the [[serve.tokens]] entry
+// that enables it
+func printNewAPIToken(name string, readOnly bool) int {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		fmt.Fprintf(os.Stderr, "goof serve: %v\n", err)
+		return exitError
+	}
+	token := "goof_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	fmt.Printf("Token (shown only once): %s\n\n", token)
+	fmt.Printf("Add this to %s and restart goof serve:\n\n", configFilePath())
+	fmt.Printf("[[serve.tokens]]\nname = %q\nsha256 = %q\n", name, hashAPIToken(token))
+	if readOnly {
+		fmt.Println("read_only = true")
+	}
+	return exitOK
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/health", s.handleHealth)
+	mux.HandleFunc("GET /api/v1/openapi.yaml", s.handleOpenAPIYAML)
+	mux.HandleFunc("GET /api/v1/openapi.json", s.handleOpenAPIJSON)
+	mux.Handle("GET /api/v1/reports", s.authorize(s.handleListReports, false))
+	mux.Handle("POST /api/v1/reports", s.authorize(s.handleCreateReport, true))
+	mux.Handle("GET /api/v1/reports/{id}", s.authorize(s.handleGetReport, false))
+	mux.Handle("PUT /api/v1/reports/{id}", s.authorize(s.handleReplaceReport, true))
+	mux.Handle("PATCH /api/v1/reports/{id}", s.authorize(s.handleUpdateReport, true))
+	mux.Handle("DELETE /api/v1/reports/{id}", s.authorize(s.handleDeleteReport, true))
+	// Previewing saves nothing, so read-only tokens may do it too
+	mux.Handle("POST /api/v1/preview", s.authorize(s.handlePreview, false))
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "no such endpoint")
+	})
+	mux.Handle("/", webUIHandler())
+	return logRequests(mux)
+}
+
+// authorize lets a request through with a valid bearer token. Read-only
+// tokens are turned away from handlers that write reports.
+func (s *server) authorize(next http.HandlerFunc, writes bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.noAuth {
+			next(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="goof"`)
+			writeError(w, http.StatusUnauthorized, "an API token is required")
+			return
+		}
+		matched := s.lookUpToken(token)
+		if matched == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="goof", error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, "invalid API token")
+			return
+		}
+		if matched.ReadOnly && writes {
+			writeError(w, http.StatusForbidden, "this API token is read-only")
+			return
+		}
+		slog.Debug("API request authorized", "token", matched.Name)
+		next(w, r)
+	})
+}
+
+func (s *server) lookUpToken(token string) *apiTokenConfig {
+	hash := []byte(hashAPIToken(token))
+	for i := range s.tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(strings.ToLower(s.tokens[i].SHA256))) == 1 {
+			return &s.tokens[i]
+		}
+	}
+	return nil
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *server) handleOpenAPIYAML(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPISpec)
+}
+
+func (s *server) handleOpenAPIJSON(w http.ResponseWriter, r *http.Request) {
+	var spec interface{}
+	if err := yaml.Unmarshal(openAPISpec, &spec); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, spec)
+}
+
+func (s *server) handleListReports(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	reports, err := SearchErrorReports(filter)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if reports == nil {
+		reports = []ErrorReport{}
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// filterFromQuery reads a Filter from query parameters named like the flags
+// of goof search
+func filterFromQuery(query url.Values) (Filter, error) {
+	filter := Filter{
+		Q:              query.Get("q"),
+		Symptom:        query.Get("symptom"),
+		Program:        query.Get("program"),
+		ProgramVersion: query.Get("program_version"),
+		Distro:         query.Get("distro"),
+		DistroVersion:  query.Get("distro_version"),
+		Team:           query.Get("team"),
+		Solution:       query.Get("solution"),
+		Fingerprint:    query.Get("fingerprint"),
+		ResourcesAny:   query["resource"],
+	}
+
+	for param, field := range map[string]string{
+		"package": extractedPackages,
+		"symbol":  extractedSymbols,
+		"header":  extractedHeaders,
+		"library": extractedLibraries,
+	} {
+		if value := query.Get(param); value != "" {
+			if filter.Extracted == nil {
+				filter.Extracted = map[string]string{}
+			}
+			filter.Extracted[field] = value
+		}
+	}
+
+	var err error
+	if filter.Environment, err = keyValuesFromQuery(query["env"]); err != nil {
+		return filter, fmt.Errorf("env: %w", err)
+	}
+	if filter.PreferEnvironment, err = keyValuesFromQuery(query["prefer_env"]); err != nil {
+		return filter, fmt.Errorf("prefer_env: %w", err)
+	}
+	if filter.DateFrom, err = parseDateFlag(query.Get("from"), false); err != nil {
+		return filter, fmt.Errorf("from: %w", err)
+	}
+	if filter.DateTo, err = parseDateFlag(query.Get("to"), true); err != nil {
+		return filter, fmt.Errorf("to: %w", err)
+	}
+	return filter, nil
+}
+
+// keyValuesFromQuery parses repeated key=value parameters, returning nil for none
+func keyValuesFromQuery(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	kv := keyValueFlag{}
+	for _, value := range values {
+		if err := kv.Set(value); err != nil {
+			return nil, err
+		}
+	}
+	return kv, nil
+}
+
+func (s *server) handleGetReport(w http.ResponseWriter, r *http.Request) {
+	report, err := GetErrorReport(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *server) handleCreateReport(w http.ResponseWriter, r *http.Request) {
+	var report ErrorReport
+	if err := decodeReport(w, r, &report); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if strings.TrimSpace(report.Symptom) == "" {
+		writeError(w, http.StatusBadRequest, "a symptom is required")
+		return
+	}
+	if report.Date.IsZero() {
+		report.Date = time.Now()
+	}
+
+	s.writeMu.Lock()
+	id, err := SaveErrorReport(normalizeAPIReport(report))
+	s.writeMu.Unlock()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	saved, err := GetErrorReport(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/reports/"+url.PathEscape(id))
+	writeJSON(w, http.StatusCreated, saved)
+}
+
+// handleReplaceReport replaces every field of a report; fields left out of
+// the body are cleared, except the date, which is kept
+func (s *server) handleReplaceReport(w http.ResponseWriter, r *http.Request) {
+	s.updateReport(w, r, func(existing ErrorReport) (ErrorReport, error) {
+		var report ErrorReport
+		if err := decodeReport(w, r, &report); err != nil {
+			return report, err
+		}
+		if report.Date.IsZero() {
+			report.Date = existing.Date
+		}
+		return report, nil
+	})
+}
+
+// handleUpdateReport changes only the fields given in the body
+func (s *server) handleUpdateReport(w http.ResponseWriter, r *http.Request) {
+	s.updateReport(w, r, func(existing ErrorReport) (ErrorReport, error) {
+		err := decodeReport(w, r, &existing)
+		return existing, err
+	})
+}
+
+func (s *server) updateReport(w http.ResponseWriter, r *http.Request, change func(ErrorReport) (ErrorReport, error)) {
+	id := r.PathValue("id")
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	existing, err := GetErrorReport(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	report, err := change(existing)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if strings.TrimSpace(report.Symptom) == "" {
+		writeError(w, http.StatusBadRequest, "a symptom is required")
+		return
+	}
+	if err := UpdateErrorReport(normalizeAPIReport(report), id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	updated, err := GetErrorReport(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *server) handleDeleteReport(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	// As with goof delete, since Meilisearch accepts deletes for documents
+	// that don't exist
+	if _, err := GetErrorReport(id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if err := DeleteErrorReport(id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reportPreview is what the confirm step of a form shows before saving
+type reportPreview struct {
+	Headline   string             `json:"headline"`
+	Program    string             `json:"program"` // As it will be stored
+	Redactions []redactionFinding `json:"redactions"`
+}
+
+// handlePreview says what saving a report would detect and redact, without
+// saving it
+func (s *server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	var report ErrorReport
+	if err := decodeReport(w, r, &report); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	preview := reportPreview{
+		Headline:   deriveHeadline(report.Symptom),
+		Program:    CanonicalProgram(report.Program),
+		Redactions: previewRedactions(report, LoadConfig()),
+	}
+	if preview.Program == "" {
+		preview.Program = DetectProgram(report.Symptom)
+	}
+	if preview.Redactions == nil {
+		preview.Redactions = []redactionFinding{}
+	}
+	writeJSON(w, http.StatusOK, preview)
+}
+
+// decodeReport reads a report from the request body, rejecting unknown
+// fields so that a misspelled one isn't silently dropped
+func decodeReport(w http.ResponseWriter, r *http.Request, report *ErrorReport) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(report); err != nil {
+		return fmt.Errorf("invalid report: %w", err)
+	}
+	return nil
+}
+
+// normalizeAPIReport drops what the store derives itself, so clients can send
+// back a report they fetched
+func normalizeAPIReport(report ErrorReport) ErrorReport {
+	report.ID = ""
+	if report.Resources == nil {
+		report.Resources = []string{}
+	}
+	return report
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrReportNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	slog.Error("API store call failed", "err", err)
+	writeError(w, http.StatusBadGateway, err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiError{Error: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		slog.Debug("Failed to write response", "err", err)
+	}
+}
+
+// statusRecorder remembers the status a handler wrote, for the request log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		slog.Info("API request", "method", r.Method, "path", r.URL.Path, "status", recorder.status,
+			"latency", time.Since(start), "remote", r.RemoteAddr)
+	})
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyTokenMayPreviewButNotWrite(t *testing.T) {
+	useFileStore(t, false)
+	s := &server{tokens: []apiTokenConfig{{Name: "ci", SHA256: hashAPIToken("goof_ci"), ReadOnly: true}}}
+	handler := s.routes()
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/v1/reports", http.StatusOK},
+		{http.MethodPost, "/api/v1/preview", http.StatusOK},
+		{http.MethodPost, "/api/v1/reports", http.StatusForbidden},
+		{http.MethodDelete, "/api/v1/reports/x", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.path, strings.NewReader(`{"symptom": "KeyError: 'x'", "program": "python"}`))
+		request.Header.Set("Authorization", "Bearer goof_ci")
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		if response.Code != test.want {
+			t.Errorf("%s %s answered %d, want %d: %s", test.method, test.path, response.Code, test.want, response.Body)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/term"
+)
+
+// stdinIsPiped reports whether stdin is a pipe or a file. Anything else that
+// isn't a terminal, such as /dev/null in CI or the socket ssh runs a command
+// with, may never reach EOF, so it isn't read unless asked for.
+func stdinIsPiped() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode().IsRegular() || info.Mode()&os.ModeNamedPipe != 0
+}
+
+// stdinIsTerminal reports whether stdin is a terminal keys can be read from
+func stdinIsTerminal() bool {
+	return term.IsTerminal(os.Stdin.Fd())
+}
+
+// readPipedInput reads everything piped into goof, e.g. `make 2>&1 | goof`.
+// Colour codes are stripped since compilers add them when forced to.
+func readPipedInput() (string, error) {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(ansi.Strip(string(data)), "\n"), nil
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reportIDProgram matches what can't go in a report ID: Meilisearch only
+// accepts letters, digits, "-" and "_", so "gnu make" is saved as gnu_make
+var reportIDProgram = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// ErrReportNotFound is returned when no report exists with the requested ID
+var ErrReportNotFound = errors.New("error report not found")
+
+// Store is where reports are kept. Stores hold the documents built by
+// reportDocument, so derived fields such as the headline and fingerprint are
+// computed the same way whatever the backend.
+type Store interface {
+	Search(filter Filter) ([]ErrorReport, error)
+	Get(id string) (ErrorReport, error)
+	All() ([]ErrorReport, error)
+	Put(document map[string]interface{}) error // Adds or replaces by ID
+	Delete(id string) error
+	Initialize() error // Prepares the index or file for first use
+	// NeedsInitialization reports whether Initialize has yet to run, or the
+	// index has drifted from what it sets up
+	NeedsInitialization() (bool, error)
+}
+
+// openStore returns the store the config's backend names, initializing it
+// first if it's the first use this run and it needs it
+func openStore(config Config) (Store, error) {
+	store, err := newStore(config)
+	if err != nil {
+		return nil, err
+	}
+	ensureStore(store)
+	return store, nil
+}
+
+var (
+	ensureStoreOnce        sync.Once
+	ensureStoreInitialized bool
+	ensureStoreErr         error
+)
+
+// ensureStore initializes the store if it needs it, once per run, and
+// reports whether it did. Failing to check is not an error, since keys that
+// may only search (tenant tokens, say) can't read the settings; the store is
+// then used as it is.
+func ensureStore(store Store) (bool, error) {
+	ensureStoreOnce.Do(func() {
+		needed, err := store.NeedsInitialization()
+		if err != nil {
+			slog.Debug("Couldn't check whether the store needs initializing", "err", err)
+			return
+		}
+		if !needed {
+			return
+		}
+		slog.Info("Initializing the store on first use")
+		if ensureStoreErr = store.Initialize(); ensureStoreErr == nil {
+			ensureStoreInitialized = true
+		}
+	})
+	return ensureStoreInitialized, ensureStoreErr
+}
+
+// newStore returns the store the config's backend names
+func newStore(config Config) (Store, error) {
+	var store Store
+	switch config.Backend {
+	case backendMeilisearch:
+		store = meilisearchStore{config}
+	case backendFile:
+		store = fileStore{config.StorePath}
+	default:
+		return nil, fmt.Errorf("unknown backend %q (want %q or %q)", config.Backend, backendMeilisearch, backendFile)
+	}
+	return loggedStore{store, slog.With("backend", config.Backend, "profile", config.Profile)}, nil
+}
+
+// loggedStore logs every call to the store it wraps, with the operation, the
+// report ID where there is one, how long it took and how it went
+type loggedStore struct {
+	store  Store
+	logger *slog.Logger
+}
+
+func (s loggedStore) log(operation string, start time.Time, err error, attrs ...any) {
+	attrs = append(attrs, "operation", operation, "latency", time.Since(start))
+	if err != nil {
+		s.logger.Error("Store call failed", append(attrs, "err", err)...)
+		return
+	}
+	s.logger.Debug("Store call", attrs...)
+}
+
+func (s loggedStore) Search(filter Filter) ([]ErrorReport, error) {
+	start := time.Now()
+	reports, err := s.store.Search(filter)
+	s.log("search", start, err, "query", filter.Q, "program", filter.Program, "hits", len(reports))
+	return reports, err
+}
+
+func (s loggedStore) Get(id string) (ErrorReport, error) {
+	start := time.Now()
+	report, err := s.store.Get(id)
+	if errors.Is(err, ErrReportNotFound) {
+		// Not finding a report is an answer, not a failure
+		s.log("get", start, nil, "report_id", id, "found", false)
+		return report, err
+	}
+	s.log("get", start, err, "report_id", id)
+	return report, err
+}
+
+func (s loggedStore) All() ([]ErrorReport, error) {
+	start := time.Now()
+	reports, err := s.store.All()
+	s.log("all", start, err, "reports", len(reports))
+	return reports, err
+}
+
+func (s loggedStore) Put(document map[string]interface{}) error {
+	start := time.Now()
+	err := s.store.Put(document)
+	s.log("put", start, err, "report_id", getString(document, "id"))
+	return err
+}
+
+func (s loggedStore) Delete(id string) error {
+	start := time.Now()
+	err := s.store.Delete(id)
+	s.log("delete", start, err, "report_id", id)
+	return err
+}
+
+func (s loggedStore) NeedsInitialization() (bool, error) {
+	start := time.Now()
+	needed, err := s.store.NeedsInitialization()
+	s.log("check", start, err, "needs_initialization", needed)
+	return needed, err
+}
+
+func (s loggedStore) Initialize() error {
+	start := time.Now()
+	err := s.store.Initialize()
+	s.log("initialize", start, err)
+	return err
+}
+
+func SearchErrorReports(filter Filter) ([]ErrorReport, error) {
+	config := LoadConfig()
+	store, err := openStore(config)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := store.Search(filter)
+	if err != nil {
+		return nil, err
+	}
+	decryptReports(reports, config.EncryptionKey)
+
+	// Reports recorded on a machine like this one are more likely to apply
+	if len(filter.PreferEnvironment) > 0 {
+		rankByEnvironment(reports, filter.PreferEnvironment)
+	}
+
+	return reports, nil
+}
+
+// FindReportsForSymptom looks up reports for a fresh error: reports with the
+// same fingerprint are exact matches, otherwise it falls back to a fuzzy
+// search on the first error line
+func FindReportsForSymptom(symptom string, filter Filter) ([]ErrorReport, error) {
+	filter.Fingerprint = Fingerprint(symptom)
+	if filter.Fingerprint != "" {
+		reports, err := SearchErrorReports(filter)
+		if err != nil || len(reports) > 0 {
+			return reports, err
+		}
+	}
+
+	filter.Fingerprint = ""
+	filter.Q = strings.TrimSpace(filter.Q + " " + symptomQuery(symptom))
+	return SearchErrorReports(filter)
+}
+
+func GetErrorReport(id string) (ErrorReport, error) {
+	config := LoadConfig()
+	store, err := openStore(config)
+	if err != nil {
+		return ErrorReport{}, err
+	}
+	report, err := store.Get(id)
+	if err != nil {
+		return report, err
+	}
+	return decryptReport(report, config.EncryptionKey), nil
+}
+
+// AllErrorReports fetches every report in the store
+func AllErrorReports() ([]ErrorReport, error) {
+	config := LoadConfig()
+	store, err := openStore(config)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := store.All()
+	if err != nil {
+		return nil, err
+	}
+	decryptReports(reports, config.EncryptionKey)
+	return reports, nil
+}
+
+// SaveErrorReport stores a new report and returns the ID it was given
+func SaveErrorReport(report ErrorReport) (string, error) {
+	config := LoadConfig()
+	store, err := openStore(config)
+	if err != nil {
+		return "", err
+	}
+
+	report = canonicalizeProgram(redactBeforeSaving(report, config))
+	if report, err = encryptReport(report, config.EncryptionKey); err != nil {
+		return "", err
+	}
+
+	// Generate unique ID based on timestamp and program
+	id := fmt.Sprintf("%d-%s", time.Now().UnixNano(), reportIDProgram.ReplaceAllString(report.Program, "_"))
+
+	if err := store.Put(reportDocument(report, id)); err != nil {
+		return "", fmt.Errorf("failed to save error report: %w", err)
+	}
+
+	return id, nil
+}
+
+func UpdateErrorReport(report ErrorReport, originalID string) error {
+	config := LoadConfig()
+	store, err := openStore(config)
+	if err != nil {
+		return err
+	}
+
+	report = canonicalizeProgram(redactBeforeSaving(report, config))
+
+	// A solution that couldn't be decrypted here is kept as it's stored
+	if report.Solution == lockedSolution {
+		stored, err := store.Get(originalID)
+		if err != nil {
+			return fmt.Errorf("failed to update error report: %w", err)
+		}
+		report.Solution = stored.Solution
+	}
+	if report, err = encryptReport(report, config.EncryptionKey); err != nil {
+		return err
+	}
+
+	// Putting a document with the same ID replaces the existing one
+	if err := store.Put(reportDocument(report, originalID)); err != nil {
+		return fmt.Errorf("failed to update error report: %w", err)
+	}
+
+	return nil
+}
+
+func DeleteErrorReport(id string) error {
+	store, err := openStore(LoadConfig())
+	if err != nil {
+		return err
+	}
+	return store.Delete(id)
+}
+
+// EnsureIndex initializes the index if it's missing or mis-configured,
+// reporting whether it did. It's safe to call any number of times.
+func EnsureIndex() (bool, error) {
+	store, err := newStore(LoadConfig())
+	if err != nil {
+		return false, err
+	}
+	return ensureStore(store)
+}
+
+// InitializeIndexIfNeeded applies the index settings unconditionally
+func InitializeIndexIfNeeded() error {
+	store, err := newStore(LoadConfig())
+	if err != nil {
+		return err
+	}
+	return store.Initialize()
+}
+
+// redactBeforeSaving strips secrets and personal details from the report's
+// free text, as configured in the [redaction] table
+func redactBeforeSaving(report ErrorReport, config Config) ErrorReport {
+	report, findings := redactReport(report, config.Redaction, config.EncryptionKey != "")
+	if len(findings) > 0 {
+		slog.Info("Redacted report before saving", "redactions", len(findings))
+	}
+	return report
+}
+
+// canonicalizeProgram stores the program under its canonical name, detecting
+// it from the symptom when left blank, and learns the name the symptom used
+// for it
+func canonicalizeProgram(report ErrorReport) ErrorReport {
+	if strings.TrimSpace(report.Program) == "" {
+		report.Program = DetectProgram(report.Symptom)
+		return report
+	}
+	learnProgramAlias(report.Symptom, report.Program)
+	report.Program = CanonicalProgram(report.Program)
+	return report
+}
+
+// matchesProgramAliases reports whether a stored program name is one of
+// aliases, also when the report was saved before programs were
+// canonicalized and the name is e.g. "GCC" or "gcc-13"
+func matchesProgramAliases(name string, aliases []string) bool {
+	return slices.Contains(aliases, strings.ToLower(strings.TrimSpace(name))) ||
+		slices.Contains(aliases, cleanProgramName(name))
+}
+
+// programFilterAliases returns every name to match for a program filter, or
+// nil when the program isn't known well enough to expand
+func programFilterAliases(program string) []string {
+	if program == "" {
+		return nil
+	}
+	if canonical := CanonicalProgram(program); isKnownProgram(canonical) {
+		return ProgramAliases(canonical)
+	}
+	return nil
+}
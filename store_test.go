@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Reports saved before programs were canonicalized keep the name they were
+// filed under, and a program search still finds them
+func TestProgramSearchFindsUncanonicalizedReports(t *testing.T) {
+	store := useFileStore(t, false)
+	old := ErrorReport{Symptom: "internal compiler error: Segmentation fault", Program: "GCC-13", Date: time.Now()}
+	if err := store.Put(reportDocument(old, "old")); err != nil {
+		t.Fatal(err)
+	}
+	other := ErrorReport{Symptom: "internal compiler error: Segmentation fault", Program: "clang", Date: time.Now()}
+	if err := store.Put(reportDocument(other, "other")); err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := store.Search(Filter{Program: "gcc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].ID != "old" {
+		t.Errorf("-program gcc found %+v, want only the report filed under GCC-13", reports)
+	}
+}
+
+func TestMeilisearchProgramFilterIncludesStoredNames(t *testing.T) {
+	var filters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Filter interface{} `json:"filter"`
+			Facets []string    `json:"facets"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/json")
+		if len(request.Facets) > 0 {
+			w.Write([]byte(`{"hits": [], "facetDistribution": {"program": {"GCC-13": 2, "gcc": 5, "clang": 1}}}`))
+			return
+		}
+		if filter, ok := request.Filter.(string); ok {
+			filters = append(filters, filter)
+		}
+		w.Write([]byte(`{"hits": []}`))
+	}))
+	defer server.Close()
+
+	store := meilisearchStore{Config{MeilisearchURL: server.URL, IndexName: "errors"}}
+	if _, err := store.Search(Filter{Program: "gcc"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 1 {
+		t.Fatalf("sent filters %q, want one search", filters)
+	}
+	if !strings.Contains(filters[0], `"GCC-13"`) || strings.Contains(filters[0], "clang") {
+		t.Errorf("program filter %q should include GCC-13 and not clang", filters[0])
+	}
+}
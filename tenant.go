@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/meilisearch/meilisearch-go"
+)
+
+// tenantTokenClaims are the claims of a Meilisearch tenant token: the UID of
+// the key that signed it and the search rules it's limited to
+type tenantTokenClaims struct {
+	APIKeyUID   string                 `json:"apiKeyUid"`
+	SearchRules map[string]interface{} `json:"searchRules"`
+	jwt.RegisteredClaims
+}
+
+// tenantToken is a minted token and what it allows
+type tenantToken struct {
+	Token     string     `json:"token"`
+	Index     string     `json:"index"`
+	Filter    string     `json:"filter,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// mintTenantToken signs a token that can only search index, and only the
+// reports matching every filter. Meilisearch checks it against the parent key
+// (whose UID is keyUID), so it stops working if that key is deleted.
+func mintTenantToken(parentKey Secret, keyUID, index string, filters []string, expiresAt time.Time) (tenantToken, error) {
+	if parentKey == "" {
+		return tenantToken{}, errors.New("no parent key to sign the token with")
+	}
+	if keyUID == "" {
+		return tenantToken{}, errors.New("the parent key's UID is needed")
+	}
+
+	minted := tenantToken{Index: index}
+	rule := map[string]interface{}{}
+	if len(filters) > 0 {
+		clauses := make([]string, len(filters))
+		for i, filter := range filters {
+			clauses[i] = "(" + filter + ")"
+		}
+		minted.Filter = strings.Join(clauses, " AND ")
+		rule["filter"] = minted.Filter
+	}
+
+	claims := tenantTokenClaims{
+		APIKeyUID:   keyUID,
+		SearchRules: map[string]interface{}{index: rule},
+	}
+	if !expiresAt.IsZero() {
+		claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+		minted.ExpiresAt = &expiresAt
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(parentKey.Reveal()))
+	if err != nil {
+		return tenantToken{}, fmt.Errorf("failed to sign tenant token: %w", err)
+	}
+	minted.Token = token
+	return minted, nil
+}
+
+// lookUpKeyUID asks Meilisearch for the UID of config's key. It warns when the
+// key couldn't sign a token that searches the index.
+func lookUpKeyUID(config Config) (string, error) {
+	client := meilisearch.New(config.MeilisearchURL, meilisearch.WithAPIKey(config.MeilisearchKey.Reveal()))
+	key, err := client.GetKey(config.MeilisearchKey.Reveal())
+	if err != nil {
+		return "", fmt.Errorf("failed to look up the key's UID (pass -key-uid if the key can't read keys): %w", err)
+	}
+
+	if !slices.Contains(key.Actions, "*") && !slices.Contains(key.Actions, "search") {
+		fmt.Fprintln(os.Stderr, "goof token: warning: the parent key can't search, so neither can the token")
+	}
+	if !slices.Contains(key.Indexes, "*") && !slices.Contains(key.Indexes, config.IndexName) {
+		fmt.Fprintf(os.Stderr, "goof token: warning: the parent key has no access to %s\n", config.IndexName)
+	}
+	return key.UID, nil
+}
+
+func runTokenCommand(args []string) int {
+	fs := newFlagSet("token")
+	var filters stringList
+	fs.Var(&filters, "filter", "Only let the token see reports matching this Meilisearch filter, e.g. 'program = gcc' (repeatable, all must match)")
+	team := fs.String("team", "", "Only let the token see reports of this team")
+	expires := fs.Duration("expires", 30*24*time.Hour, "How long the token is valid for; 0 for no expiry")
+	keyUID := fs.String("key-uid", "", "UID of the parent key (looked up on the server if not given)")
+	asJSON := fs.Bool("json", false, "Print the token with its index, filter and expiry as JSON")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return parseExitCode(err)
+	}
+	if len(positional) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: goof token [-team name] [-filter expr]... [-expires duration] [-key-uid uid] [-json]")
+		return exitError
+	}
+	if *team != "" {
+		filters = append([]string{"team = " + quoteFilterValue(*team)}, filters...)
+	}
+
+	config := LoadConfig()
+	if config.Backend != backendMeilisearch {
+		fmt.Fprintf(os.Stderr, "goof token: tenant tokens need the %s backend\n", backendMeilisearch)
+		return exitError
+	}
+	if *keyUID == "" {
+		if *keyUID, err = lookUpKeyUID(config); err != nil {
+			fmt.Fprintf(os.Stderr, "goof token: %v\n", err)
+			return exitError
+		}
+	}
+
+	var expiresAt time.Time
+	if *expires > 0 {
+		expiresAt = time.Now().Add(*expires).UTC().Truncate(time.Second)
+	}
+	minted, err := mintTenantToken(config.MeilisearchKey, *keyUID, config.IndexName, filters, expiresAt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goof token: %v\n", err)
+		return exitError
+	}
+
+	if *asJSON {
+		if err := printJSON(minted); err != nil {
+			fmt.Fprintf(os.Stderr, "goof token: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+	fmt.Println(minted.Token)
+	return exitOK
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Styles for the TUI, set by applyTheme
+var (
+	titleStyle     = lipgloss.NewStyle()
+	selectionStyle = lipgloss.NewStyle().Reverse(true)
+	statusStyle    = lipgloss.NewStyle()
+)
+
+// applyTheme sets the TUI styles for a theme name from the config: "default",
+// "light", "dark" or "none" for plain text
+func applyTheme(name string) {
+	switch name {
+	case "none":
+		titleStyle = lipgloss.NewStyle()
+		selectionStyle = lipgloss.NewStyle()
+		statusStyle = lipgloss.NewStyle()
+	case "light":
+		titleStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("25"))
+		selectionStyle = lipgloss.NewStyle().Background(lipgloss.Color("153")).Foreground(lipgloss.Color("16"))
+		statusStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("130"))
+	case "dark":
+		titleStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("117"))
+		selectionStyle = lipgloss.NewStyle().Background(lipgloss.Color("24")).Foreground(lipgloss.Color("231"))
+		statusStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("221"))
+	default:
+		if name != "default" {
+			slog.Warn("Unknown theme, using the default", "theme", name)
+		}
+		titleStyle = lipgloss.NewStyle().Bold(true)
+		selectionStyle = lipgloss.NewStyle().Reverse(true)
+		statusStyle = lipgloss.NewStyle().Faint(true)
+	}
+}
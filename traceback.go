@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxTracebackFrames is how many of the innermost frames are kept
+const maxTracebackFrames = 5
+
+// Traceback is a runtime crash pulled out of a symptom
+type Traceback struct {
+	Language      string   `json:"language"`
+	Program       string   `json:"program"`
+	ExceptionType string   `json:"exception_type"`
+	Message       string   `json:"message"`
+	Frames        []string `json:"frames,omitempty"` // Innermost first
+}
+
+// Summary renders the traceback without paths, addresses or line noise, as
+// "Type: message" followed by the top frames
+func (t *Traceback) Summary() string {
+	s := t.ExceptionType
+	if t.Message != "" {
+		s += ": " + t.Message
+	}
+	for _, frame := range t.Frames {
+		s += "\n    at " + frame
+	}
+	return s
+}
+
+// tracebackParser recognizes one runtime's crash format
+type tracebackParser struct {
+	name  string
+	parse func(lines []string) *Traceback
+}
+
+// tracebackParsers are tried in order. Summaries go first since a Go
+// summary also starts with "panic:", and Java goes before Node because both
+// print "at ..." frames and Java's header is the stricter of the two.
+var tracebackParsers = []tracebackParser{
+	{"summary", parseTracebackSummary},
+	{"python", parsePythonTraceback},
+	{"go", parseGoPanic},
+	{"java", parseJavaStackTrace},
+	{"node", parseNodeError},
+}
+
+// ParseTraceback extracts the exception and innermost frames from a Python
+// traceback, Java stack trace, Go panic or Node error
+func ParseTraceback(text string) *Traceback {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for _, parser := range tracebackParsers {
+		if traceback := parser.parse(lines); traceback != nil {
+			return traceback
+		}
+	}
+	return nil
+}
+
+// normalizeTracebackSymptom replaces a symptom holding a runtime crash with
+// the crash's Summary, dropping the paths, addresses and output around it.
+// Other symptoms, and crashes whose summary wouldn't parse back the same, are
+// left alone so nothing is lost on saving.
+func normalizeTracebackSymptom(symptom string) (string, *Traceback) {
+	traceback := ParseTraceback(symptom)
+	if traceback == nil {
+		return symptom, nil
+	}
+	summary := traceback.Summary()
+	parsed := ParseTraceback(summary)
+	if parsed == nil || parsed.Summary() != summary || parsed.Language != traceback.Language {
+		return symptom, nil
+	}
+	return summary, traceback
+}
+
+func appendFrame(frames []string, frame string) []string {
+	if len(frames) >= maxTracebackFrames {
+		return frames
+	}
+	return append(frames, frame)
+}
+
+// Python
+
+var (
+	pythonFramePattern     = regexp.MustCompile(`^\s+File "([^"]+)", line (\d+), in (.+)$`)
+	pythonExceptionPattern = regexp.MustCompile(`^([A-Za-z_][\w.]*)(?::\s?(.*))?$`)
+)
+
+func parsePythonTraceback(lines []string) *Traceback {
+	// With chained exceptions the last traceback is the one that crashed
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "Traceback (most recent call last):") {
+			start = i
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+
+	var frames []string
+	for _, line := range lines[start+1:] {
+		if m := pythonFramePattern.FindStringSubmatch(line); m != nil {
+			frames = append(frames, fmt.Sprintf("%s (%s)", m[3], filepath.Base(m[1])))
+			continue
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || line == "" {
+			continue
+		}
+
+		m := pythonExceptionPattern.FindStringSubmatch(line)
+		if m == nil {
+			return nil
+		}
+
+		// Python prints the innermost frame last
+		traceback := &Traceback{Language: "python", Program: "python", ExceptionType: m[1], Message: m[2]}
+		for i := len(frames) - 1; i >= 0; i-- {
+			traceback.Frames = appendFrame(traceback.Frames, frames[i])
+		}
+		return traceback
+	}
+	return nil
+}
+
+// Go
+
+var (
+	goPanicPattern     = regexp.MustCompile(`^(panic|fatal error): (.*?)(?: \[recovered\])?$`)
+	goGoroutinePattern = regexp.MustCompile(`^goroutine \d+ \[.*\]:$`)
+	goFuncPattern      = regexp.MustCompile(`^(\S+)\([^()]*\)$`)
+	goFileLinePattern  = regexp.MustCompile(`^\t(.+):(\d+)(?: \+0x[0-9a-f]+)?$`)
+)
+
+func parseGoPanic(lines []string) *Traceback {
+	for i, line := range lines {
+		m := goPanicPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		traceback := &Traceback{Language: "go", Program: "go", ExceptionType: m[1], Message: m[2]}
+		if rest, ok := strings.CutPrefix(m[2], "runtime error: "); ok {
+			traceback.ExceptionType = "runtime error"
+			traceback.Message = rest
+		}
+
+		// Only the first goroutine's stack; that's the one that panicked
+		inGoroutine := false
+		function := ""
+		for _, line := range lines[i+1:] {
+			switch {
+			case goGoroutinePattern.MatchString(line):
+				if inGoroutine {
+					return traceback
+				}
+				inGoroutine = true
+			case !inGoroutine:
+				continue
+			case strings.HasPrefix(line, "panic(") || strings.HasPrefix(line, "runtime."):
+				function = ""
+			case goFuncPattern.MatchString(line):
+				function = goFuncPattern.FindStringSubmatch(line)[1]
+			case goFileLinePattern.MatchString(line) && function != "":
+				file := goFileLinePattern.FindStringSubmatch(line)[1]
+				traceback.Frames = appendFrame(traceback.Frames, fmt.Sprintf("%s (%s)", function, filepath.Base(file)))
+				function = ""
+			}
+		}
+		return traceback
+	}
+	return nil
+}
+
+// Java
+
+var (
+	javaExceptionPattern  = regexp.MustCompile(`^(?:Exception in thread "[^"]*" |Caused by: )?((?:[a-zA-Z_$][\w$]*\.)+[\w$]*(?:Exception|Error|Throwable))(?::\s?(.*))?$`)
+	javaFramePattern      = regexp.MustCompile(`^\s+at ([\w$.<>/]+)\(([^)]*)\)$`)
+	javaLineNumberPattern = regexp.MustCompile(`:\d+$`)
+)
+
+func parseJavaStackTrace(lines []string) *Traceback {
+	// Report the root cause: the last "Caused by:" section with frames of its
+	// own, since the others are often just "... 12 more"
+	var rootCause, current *Traceback
+	for _, line := range lines {
+		if m := javaExceptionPattern.FindStringSubmatch(line); m != nil {
+			current = &Traceback{Language: "java", Program: "java", ExceptionType: m[1], Message: m[2]}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if m := javaFramePattern.FindStringSubmatch(line); m != nil {
+			source := javaLineNumberPattern.ReplaceAllString(m[2], "")
+			current.Frames = appendFrame(current.Frames, fmt.Sprintf("%s (%s)", m[1], source))
+			rootCause = current
+		}
+	}
+	return rootCause
+}
+
+// Node
+
+var (
+	nodeErrorPattern = regexp.MustCompile(`^(?:Uncaught )?([A-Z]\w*(?:Error|Exception)|Error)(?:: (.*))?$`)
+	nodeFramePattern = regexp.MustCompile(`^\s+at (?:(.+?) \((.+):\d+:\d+\)|(.+):\d+:\d+)$`)
+)
+
+func parseNodeError(lines []string) *Traceback {
+	for i, line := range lines {
+		m := nodeErrorPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		traceback := &Traceback{Language: "javascript", Program: "node", ExceptionType: m[1], Message: m[2]}
+		for _, line := range lines[i+1:] {
+			f := nodeFramePattern.FindStringSubmatch(line)
+			if f == nil {
+				break
+			}
+			if f[1] != "" {
+				traceback.Frames = appendFrame(traceback.Frames, fmt.Sprintf("%s (%s)", f[1], filepath.Base(f[2])))
+			} else {
+				traceback.Frames = appendFrame(traceback.Frames, filepath.Base(f[3]))
+			}
+		}
+
+		if len(traceback.Frames) > 0 {
+			return traceback
+		}
+	}
+	return nil
+}
+
+// Summaries, as normalizeTracebackSymptom leaves them
+
+var (
+	summaryExceptionPattern = regexp.MustCompile(`^(\S.*?)(?:: (.*))?$`)
+	summaryFramePattern     = regexp.MustCompile(`^    at (.+?)(?: \(([^()]*)\))?$`)
+)
+
+// summaryRuntimes tells which runtime a summary came from by the files in
+// its frames, which Summary keeps without their directories or line numbers
+var summaryRuntimes = map[string]struct{ language, program string }{
+	".py":   {"python", "python"},
+	".go":   {"go", "go"},
+	".java": {"java", "java"},
+	".js":   {"javascript", "node"},
+	".mjs":  {"javascript", "node"},
+	".cjs":  {"javascript", "node"},
+	".ts":   {"javascript", "node"},
+}
+
+func parseTracebackSummary(lines []string) *Traceback {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) < 2 {
+		return nil
+	}
+	m := summaryExceptionPattern.FindStringSubmatch(lines[0])
+	if m == nil {
+		return nil
+	}
+
+	traceback := &Traceback{ExceptionType: m[1], Message: m[2]}
+	for _, line := range lines[1:] {
+		f := summaryFramePattern.FindStringSubmatch(line)
+		if f == nil {
+			return nil
+		}
+		file := f[2]
+		if file == "" {
+			file = f[1]
+		}
+		if runtime, ok := summaryRuntimes[filepath.Ext(file)]; ok && traceback.Language == "" {
+			traceback.Language, traceback.Program = runtime.language, runtime.program
+		}
+		traceback.Frames = appendFrame(traceback.Frames, f[0][len("    at "):])
+	}
+	if traceback.Language == "" {
+		return nil
+	}
+	return traceback
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+var tracebackTests = []struct {
+	name    string
+	output  string
+	program string
+	summary string
+}{
+	{
+		"python",
+		"Running migrations...\n" +
+			"Traceback (most recent call last):\n" +
+			"  File \"/home/al/app/manage.py\", line 22, in <module>\n" +
+			"    main()\n" +
+			"  File \"/home/al/app/settings.py\", line 8, in load\n" +
+			"    return config[\"DATABASE_URL\"]\n" +
+			"KeyError: 'DATABASE_URL'\n",
+		"python",
+		"KeyError: 'DATABASE_URL'\n    at load (settings.py)\n    at <module> (manage.py)",
+	},
+	{
+		"go",
+		"panic: runtime error: index out of range [3] with length 3\n\n" +
+			"goroutine 1 [running]:\n" +
+			"main.pick(...)\n" +
+			"\t/home/al/src/tool/main.go:12\n" +
+			"main.main()\n" +
+			"\t/home/al/src/tool/main.go:7 +0x1d\n" +
+			"exit status 2\n",
+		"go",
+		"runtime error: index out of range [3] with length 3\n    at main.pick (main.go)\n    at main.main (main.go)",
+	},
+	{
+		"java",
+		"Exception in thread \"main\" java.lang.IllegalStateException: no config\n" +
+			"\tat com.example.App.load(App.java:31)\n" +
+			"\tat jdk.internal.reflect.DirectMethodHandleAccessor.invoke(DirectMethodHandleAccessor.java:103)\n" +
+			"\tat com.example.App.main(App.java:9)\n",
+		"java",
+		"java.lang.IllegalStateException: no config\n    at com.example.App.load (App.java)\n" +
+			"    at jdk.internal.reflect.DirectMethodHandleAccessor.invoke (DirectMethodHandleAccessor.java)\n" +
+			"    at com.example.App.main (App.java)",
+	},
+	{
+		"node",
+		"TypeError: Cannot read properties of undefined (reading 'port')\n" +
+			"    at startServer (/srv/app/server.js:14:22)\n" +
+			"    at /srv/app/index.js:3:1\n",
+		"node",
+		"TypeError: Cannot read properties of undefined (reading 'port')\n    at startServer (server.js)\n    at index.js",
+	},
+}
+
+func TestNormalizeTracebackSymptom(t *testing.T) {
+	for _, test := range tracebackTests {
+		t.Run(test.name, func(t *testing.T) {
+			symptom, traceback := normalizeTracebackSymptom(test.output)
+			if traceback == nil {
+				t.Fatal("no traceback found")
+			}
+			if symptom != test.summary {
+				t.Errorf("normalized symptom %q, want %q", symptom, test.summary)
+			}
+
+			// The summary parses back to the same crash, so it is saved with
+			// its traceback and normalizing again changes nothing
+			parsed := ParseTraceback(symptom)
+			if parsed == nil || parsed.Language != traceback.Language || parsed.Program != test.program {
+				t.Errorf("summary parsed as %+v, want a %s traceback", parsed, traceback.Language)
+			}
+			if again, _ := normalizeTracebackSymptom(symptom); again != symptom {
+				t.Errorf("normalizing twice gave %q", again)
+			}
+		})
+	}
+
+	const compiler = "main.c:3:5: error: expected ';' before 'return'"
+	if symptom, traceback := normalizeTracebackSymptom(compiler); symptom != compiler || traceback != nil {
+		t.Errorf("compiler output was normalized to %q", symptom)
+	}
+}
+
+func TestEntryAndRunFillProgramAndSymptom(t *testing.T) {
+	useFileStore(t, false)
+	for _, test := range tracebackTests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newEntryModel(ErrorReport{})
+			m.saveEntryField(test.output)
+			if m.currentReport.Program != test.program || m.currentReport.Symptom != test.summary {
+				t.Errorf("entry filled program %q and symptom %q", m.currentReport.Program, m.currentReport.Symptom)
+			}
+			if !strings.Contains(m.status, "traceback") {
+				t.Errorf("entry status %q doesn't say the symptom was normalized", m.status)
+			}
+
+			report := newRunReport([]string{"./run-tests.sh"}, strings.TrimSpace(test.output))
+			if report.Program != test.program || report.Symptom != test.summary {
+				t.Errorf("goof run filled program %q and symptom %q", report.Program, report.Symptom)
+			}
+		})
+	}
+}
@@ -3,26 +3,39 @@ package main
 import "time"
 
 type ErrorReport struct {
-	ID             string    `json:"id,omitempty"`
-	Symptom        string    `json:"symptom"`
-	Date           time.Time `json:"date"`
-	Program        string    `json:"program"`
-	ProgramVersion string    `json:"program_version"`
-	Distro         string    `json:"distro"`
-	DistroVersion  string    `json:"distro_version"`
-	Resources      []string  `json:"resources"`
-	Solution       string    `json:"solution"`
+	ID             string              `json:"id,omitempty"`
+	Symptom        string              `json:"symptom"`
+	Headline       string              `json:"headline"` // Primary compiler message, derived from the symptom
+	Date           time.Time           `json:"date"`
+	Program        string              `json:"program"`
+	ProgramVersion string              `json:"program_version"`
+	Distro         string              `json:"distro"`
+	DistroVersion  string              `json:"distro_version"`
+	Team           string              `json:"team"`        // Who the report belongs to, for scoping tenant tokens
+	Environment    map[string]string   `json:"environment"` // Machine fingerprint: arch, toolchain, locale, CC, ...
+	Fingerprint    string              `json:"fingerprint"` // Hash of the normalized symptom, see Fingerprint
+	Diagnostics    []Diagnostic        `json:"diagnostics"` // Compiler diagnostics parsed from the symptom
+	Traceback      *Traceback          `json:"traceback"`   // Runtime crash parsed from the symptom
+	Extracted      map[string][]string `json:"extracted"`   // Packages, symbols, headers, ... see RecognizeErrors
+	Resources      []string            `json:"resources"`
+	Solution       string              `json:"solution"`
+	Relevance      float64             `json:"-"` // How well the report matched a search, from 0 to 1
 }
 
 type Filter struct {
-	Q              string     `json:"q,omitempty"`               // General search query
-	Symptom        string     `json:"symptom,omitempty"`         // Filter by symptom
-	Program        string     `json:"program,omitempty"`         // Filter by program
-	ProgramVersion string     `json:"program_version,omitempty"` // Filter by program version
-	Distro         string     `json:"distro,omitempty"`          // Filter by distro
-	DistroVersion  string     `json:"distro_version,omitempty"`  // Filter by distro version
-	DateFrom       *time.Time `json:"date_from,omitempty"`       // Filter by date range (from)
-	DateTo         *time.Time `json:"date_to,omitempty"`         // Filter by date range (to)
-	ResourcesAny   []string   `json:"resources_any,omitempty"`   // Filter by any of these resources
-	Solution       string     `json:"solution,omitempty"`        // Filter by solution text
+	Q                 string            `json:"q,omitempty"`                  // General search query
+	Symptom           string            `json:"symptom,omitempty"`            // Filter by symptom
+	Program           string            `json:"program,omitempty"`            // Filter by program
+	ProgramVersion    string            `json:"program_version,omitempty"`    // Filter by program version
+	Distro            string            `json:"distro,omitempty"`             // Filter by distro
+	DistroVersion     string            `json:"distro_version,omitempty"`     // Filter by distro version
+	Team              string            `json:"team,omitempty"`               // Filter by exact team
+	DateFrom          *time.Time        `json:"date_from,omitempty"`          // Filter by date range (from)
+	DateTo            *time.Time        `json:"date_to,omitempty"`            // Filter by date range (to)
+	ResourcesAny      []string          `json:"resources_any,omitempty"`      // Filter by any of these resources
+	Environment       map[string]string `json:"environment,omitempty"`        // Filter by exact environment values
+	Fingerprint       string            `json:"fingerprint,omitempty"`        // Filter by exact symptom fingerprint
+	Extracted         map[string]string `json:"extracted,omitempty"`          // Filter by extracted values, e.g. symbols=foo
+	PreferEnvironment map[string]string `json:"prefer_environment,omitempty"` // Rank reports matching this environment ahead of equally relevant ones
+	Solution          string            `json:"solution,omitempty"`           // Filter by solution text
 }
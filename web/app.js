@@ -0,0 +1,486 @@
+// The goof web UI: search, results, a report's details and the entry and
+// edit forms, following the TUI. It only talks to the goof API.
+"use strict";
+
+const app = document.getElementById("app");
+const statusLine = document.getElementById("status");
+const signOut = document.getElementById("sign-out");
+
+// lockedSolution matches the placeholder the server sends for a solution it
+// has no key to decrypt, see encryption.go
+const lockedSolution = "[Encrypted solution: no key to decrypt it on this machine]";
+
+// maxRedactionPreview matches the TUI's confirm step
+const maxRedactionPreview = 8;
+
+const searchFields = [
+  ["q", "General Query"],
+  ["symptom", "Symptom"],
+  ["program", "Program"],
+  ["program_version", "Program Version"],
+  ["distro", "Distro"],
+  ["distro_version", "Distro Version"],
+  ["team", "Team"],
+  ["solution", "Solution"],
+];
+
+// h builds an element. Strings become text nodes, so report text is never
+// parsed as HTML.
+function h(tag, attrs, ...children) {
+  const el = document.createElement(tag);
+  for (const [name, value] of Object.entries(attrs || {})) {
+    if (value === false || value === null || value === undefined) {
+      continue;
+    }
+    if (name.startsWith("on")) {
+      el.addEventListener(name.slice(2), value);
+    } else {
+      el.setAttribute(name, value === true ? "" : value);
+    }
+  }
+  for (const child of children.flat()) {
+    if (child !== null && child !== undefined && child !== false) {
+      el.append(child instanceof Node ? child : String(child));
+    }
+  }
+  return el;
+}
+
+function showStatus(message, isError) {
+  statusLine.textContent = message;
+  statusLine.className = isError ? "error" : "";
+  statusLine.hidden = !message;
+}
+
+// Tokens are kept for the tab only, unless the user asks to be remembered
+function apiToken() {
+  return sessionStorage.getItem("goof-token") || localStorage.getItem("goof-token") || "";
+}
+
+function setAPIToken(token, remember) {
+  sessionStorage.removeItem("goof-token");
+  localStorage.removeItem("goof-token");
+  if (token) {
+    (remember ? localStorage : sessionStorage).setItem("goof-token", token);
+  }
+  signOut.hidden = !token;
+}
+
+class TokenRequired extends Error {}
+
+// flash is shown once the next view has rendered, e.g. "Report saved"
+let flash = "";
+
+async function api(method, path, body) {
+  const headers = { Accept: "application/json" };
+  const token = apiToken();
+  if (token) {
+    headers.Authorization = "Bearer " + token;
+  }
+  if (body !== undefined) {
+    headers["Content-Type"] = "application/json";
+  }
+  const response = await fetch("/api/v1" + path, {
+    method,
+    headers,
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  if (response.status === 401) {
+    throw new TokenRequired();
+  }
+  if (response.status === 204) {
+    return null;
+  }
+  const data = await response.json().catch(() => null);
+  if (!response.ok) {
+    throw new Error((data && data.error) || `${response.status} ${response.statusText}`);
+  }
+  return data;
+}
+
+// reportSummary is the one-line description of a report shown in lists, as
+// in the TUI
+function reportSummary(report) {
+  return report.headline || (report.symptom || "").split("\n")[0];
+}
+
+function formatDate(date) {
+  return date ? String(date).slice(0, 10) : "";
+}
+
+function formatEnvironment(env) {
+  return Object.keys(env || {})
+    .sort()
+    .map((key) => `${key}=${env[key]}`)
+    .join(", ");
+}
+
+function parseEnvironment(text) {
+  const env = {};
+  for (const line of text.split("\n")) {
+    const trimmed = line.trim();
+    if (!trimmed) {
+      continue;
+    }
+    const eq = trimmed.indexOf("=");
+    if (eq <= 0) {
+      throw new Error(`Environment: expected key=value, got "${trimmed}"`);
+    }
+    env[trimmed.slice(0, eq).trim()] = trimmed.slice(eq + 1).trim();
+  }
+  return env;
+}
+
+// route renders the view named by the URL fragment
+async function route() {
+  const hash = location.hash.replace(/^#\/?/, "");
+  const [path, query] = hash.split("?");
+  const parts = path.split("/").map(decodeURIComponent);
+  window.scrollTo(0, 0);
+  try {
+    if (parts[0] === "reports" && parts[1] && parts[2] === "edit") {
+      await viewForm(parts[1]);
+    } else if (parts[0] === "reports" && parts[1]) {
+      await viewReport(parts[1]);
+    } else if (parts[0] === "new") {
+      await viewForm(null);
+    } else {
+      await viewSearch(new URLSearchParams(query || ""));
+    }
+    showStatus(flash);
+    flash = "";
+  } catch (err) {
+    if (err instanceof TokenRequired) {
+      viewToken();
+      return;
+    }
+    showStatus(err.message, true);
+  }
+}
+
+function viewToken() {
+  const hadToken = apiToken() !== "";
+  setAPIToken("");
+  const input = h("input", { type: "password", id: "token", autocomplete: "off", required: true });
+  const remember = h("input", { type: "checkbox", id: "remember" });
+  app.replaceChildren(
+    h("h1", {}, "API token"),
+    h("p", {}, hadToken ? "The server didn't accept that token. " : "This server needs an API token. ",
+      "Create one with ", h("code", {}, "goof serve -new-token <name>"), "."),
+    h("form", {
+      class: "fields",
+      onsubmit: (event) => {
+        event.preventDefault();
+        setAPIToken(input.value.trim(), remember.checked);
+        route();
+      },
+    },
+      h("label", { for: "token" }, "Token"), input,
+      h("span"), h("label", { class: "check" }, remember, " Remember on this browser"),
+      h("span"), h("div", { class: "actions" }, h("button", { type: "submit" }, "Continue")),
+    ),
+  );
+  input.focus();
+}
+
+async function viewSearch(params) {
+  const inputs = {};
+  const form = h("form", {
+    class: "fields",
+    onsubmit: (event) => {
+      event.preventDefault();
+      const next = new URLSearchParams();
+      for (const [name, input] of Object.entries(inputs)) {
+        if (input.value.trim()) {
+          next.set(name, input.value.trim());
+        }
+      }
+      const target = "#/search?" + next.toString();
+      if (location.hash === target) {
+        route();
+      } else {
+        location.hash = target;
+      }
+    },
+  });
+  for (const [name, label] of [...searchFields, ["from", "From"], ["to", "To"]]) {
+    const type = name === "from" || name === "to" ? "date" : "search";
+    inputs[name] = h("input", { type, id: "search-" + name, name, value: params.get(name) || "" });
+    form.append(h("label", { for: "search-" + name }, label), inputs[name]);
+  }
+  form.append(h("span"), h("div", { class: "actions" }, h("button", { type: "submit" }, "Execute Search")));
+
+  const results = h("section", { class: "results" }, h("p", { class: "muted" }, "Searching…"));
+  app.replaceChildren(h("h1", {}, "Search Error Reports"), form, results);
+  inputs.q.focus();
+
+  const reports = await api("GET", "/reports?" + params.toString());
+  if (reports.length === 0) {
+    results.replaceChildren(h("h2", {}, "Search Results"), h("p", { class: "muted" }, "No results found"));
+    return;
+  }
+  results.replaceChildren(
+    h("h2", {}, "Search Results"),
+    h("ul", { class: "report-list" }, reports.map((report) =>
+      h("li", {},
+        h("a", { href: "#/reports/" + encodeURIComponent(report.id) },
+          h("span", { class: "program" }, report.program || "?"),
+          h("span", { class: "summary" }, reportSummary(report)),
+          h("span", { class: "date" }, formatDate(report.date)),
+        ),
+      ),
+    )),
+  );
+}
+
+function field(label, ...value) {
+  return [h("dt", {}, label), h("dd", {}, ...value)];
+}
+
+async function viewReport(id) {
+  const report = await api("GET", "/reports/" + encodeURIComponent(id));
+
+  const details = h("dl", { class: "details" },
+    field("Date", formatDate(report.date)),
+    field("Program", `${report.program} ${report.program_version}`.trim()),
+    field("Distro", `${report.distro} ${report.distro_version}`.trim()),
+  );
+  if (report.team) {
+    details.append(...field("Team", report.team));
+  }
+  if (Object.keys(report.environment || {}).length > 0) {
+    details.append(...field("Environment", formatEnvironment(report.environment)));
+  }
+  if ((report.resources || []).length > 0) {
+    details.append(...field("Resources", h("ul", {}, report.resources.map((resource) =>
+      h("li", {}, /^https?:\/\//i.test(resource)
+        ? h("a", { href: resource, rel: "noopener noreferrer", target: "_blank" }, resource)
+        : resource)))));
+  }
+  const extracted = Object.keys(report.extracted || {}).sort()
+    .filter((key) => key !== "recognizer")
+    .map((key) => `${key}: ${report.extracted[key].join(", ")}`);
+  if (extracted.length > 0) {
+    details.append(...field("Extracted", extracted.join("; ")));
+  }
+
+  const solution = h("div", { class: "markdown" });
+  if (!report.solution) {
+    solution.append(h("p", { class: "muted" }, "(empty)"));
+  } else if (report.solution === lockedSolution) {
+    solution.append(h("p", { class: "muted" }, report.solution));
+  } else {
+    solution.innerHTML = markdown.render(report.solution);
+  }
+
+  app.replaceChildren(
+    h("h1", {}, reportSummary(report)),
+    h("p", { class: "muted" }, report.id),
+    details,
+    h("h2", {}, "Symptom"),
+    h("pre", { class: "symptom" }, report.symptom),
+    h("h2", {}, "Solution"),
+    solution,
+    h("div", { class: "actions" },
+      h("a", { class: "button", href: "#/reports/" + encodeURIComponent(report.id) + "/edit" }, "Edit"),
+      h("button", {
+        type: "button",
+        disabled: !report.solution || report.solution === lockedSolution,
+        onclick: () => copyText(report.solution, "Copied the solution"),
+      }, "Copy solution"),
+      h("button", {
+        type: "button",
+        class: "danger",
+        onclick: async () => {
+          if (!confirm(`Delete this report?\n\n${report.program} - ${reportSummary(report)}`)) {
+            return;
+          }
+          try {
+            await api("DELETE", "/reports/" + encodeURIComponent(report.id));
+            flash = "Report deleted";
+            location.hash = "#/";
+          } catch (err) {
+            handleError(err);
+          }
+        },
+      }, "Delete"),
+    ),
+  );
+}
+
+async function copyText(text, done) {
+  try {
+    await navigator.clipboard.writeText(text);
+    showStatus(done);
+  } catch (err) {
+    showStatus("Couldn't copy: " + err.message, true);
+  }
+}
+
+function handleError(err) {
+  if (err instanceof TokenRequired) {
+    viewToken();
+  } else {
+    showStatus(err.message, true);
+  }
+}
+
+// viewForm is the entry form for a new report, or the edit form for id
+async function viewForm(id) {
+  let report = {
+    symptom: "", program: "", program_version: "", distro: "", distro_version: "", team: "",
+    resources: [], environment: {}, solution: "",
+  };
+  if (id) {
+    report = await api("GET", "/reports/" + encodeURIComponent(id));
+  }
+
+  const inputs = {
+    symptom: h("textarea", { id: "f-symptom", rows: 8, class: "mono", required: true }),
+    program: h("input", { id: "f-program", placeholder: "Detected from the symptom when blank" }),
+    program_version: h("input", { id: "f-program_version" }),
+    distro: h("input", { id: "f-distro" }),
+    distro_version: h("input", { id: "f-distro_version" }),
+    team: h("input", { id: "f-team" }),
+    resources: h("textarea", { id: "f-resources", rows: 3, placeholder: "One per line, e.g. a URL" }),
+    environment: h("textarea", { id: "f-environment", rows: 3, class: "mono", placeholder: "key=value, one per line" }),
+    solution: h("textarea", { id: "f-solution", rows: 10, placeholder: "Markdown" }),
+  };
+  inputs.symptom.value = report.symptom || "";
+  inputs.program.value = report.program || "";
+  inputs.program_version.value = report.program_version || "";
+  inputs.distro.value = report.distro || "";
+  inputs.distro_version.value = report.distro_version || "";
+  inputs.team.value = report.team || "";
+  inputs.resources.value = (report.resources || []).join("\n");
+  inputs.environment.value = Object.keys(report.environment || {}).sort()
+    .map((key) => `${key}=${report.environment[key]}`).join("\n");
+  inputs.solution.value = report.solution || "";
+
+  const locked = report.solution === lockedSolution;
+  if (locked) {
+    inputs.solution.readOnly = true;
+  }
+
+  const solutionPreview = h("div", { class: "markdown preview" });
+  const confirmPanel = h("div", { class: "confirm" });
+
+  const current = () => ({
+    symptom: inputs.symptom.value,
+    program: inputs.program.value.trim(),
+    program_version: inputs.program_version.value.trim(),
+    distro: inputs.distro.value.trim(),
+    distro_version: inputs.distro_version.value.trim(),
+    team: inputs.team.value.trim(),
+    resources: inputs.resources.value.split("\n").map((line) => line.trim()).filter(Boolean),
+    environment: parseEnvironment(inputs.environment.value),
+    solution: inputs.solution.value,
+  });
+
+  const renderSolution = () => {
+    solutionPreview.innerHTML = inputs.solution.value && !locked
+      ? markdown.render(inputs.solution.value)
+      : "";
+  };
+
+  // The confirm step: what goof detects in the symptom and what it will
+  // redact, as the TUI shows before saving
+  let previewTimer = 0;
+  const updateConfirm = () => {
+    clearTimeout(previewTimer);
+    previewTimer = setTimeout(async () => {
+      let preview;
+      try {
+        preview = await api("POST", "/preview", current());
+      } catch (err) {
+        confirmPanel.replaceChildren();
+        return;
+      }
+      const children = [];
+      if (preview.headline) {
+        children.push(h("p", {}, h("strong", {}, "Detected: "), preview.headline));
+      }
+      if (preview.program && preview.program !== inputs.program.value.trim()) {
+        children.push(h("p", {}, h("strong", {}, "Saved under program: "), preview.program));
+      }
+      if (preview.redactions.length > 0) {
+        const shown = preview.redactions.slice(0, maxRedactionPreview);
+        children.push(
+          h("p", {}, h("strong", {}, "Will be redacted before saving:")),
+          h("ul", {}, shown.map((finding) =>
+            h("li", {}, `${finding.field}: ${finding.rule} `, h("code", {}, finding.match)))),
+        );
+        if (preview.redactions.length > shown.length) {
+          children.push(h("p", { class: "muted" }, `…and ${preview.redactions.length - shown.length} more`));
+        }
+      }
+      confirmPanel.replaceChildren(...children);
+    }, 400);
+  };
+
+  const form = h("form", {
+    class: "fields",
+    onsubmit: async (event) => {
+      event.preventDefault();
+      let body;
+      try {
+        body = current();
+      } catch (err) {
+        showStatus(err.message, true);
+        return;
+      }
+      if (!body.symptom.trim()) {
+        showStatus("A symptom is required", true);
+        return;
+      }
+      try {
+        const saved = id
+          ? await api("PATCH", "/reports/" + encodeURIComponent(id), body)
+          : await api("POST", "/reports", body);
+        flash = id ? "Report updated" : "Report saved";
+        location.hash = "#/reports/" + encodeURIComponent(saved.id);
+      } catch (err) {
+        handleError(err);
+      }
+    },
+    oninput: (event) => {
+      if (event.target === inputs.solution) {
+        renderSolution();
+      }
+      updateConfirm();
+    },
+  },
+    h("label", { for: "f-symptom" }, "Symptom"), inputs.symptom,
+    h("label", { for: "f-program" }, "Program"), inputs.program,
+    h("label", { for: "f-program_version" }, "Program Version"), inputs.program_version,
+    h("label", { for: "f-distro" }, "Distro"), inputs.distro,
+    h("label", { for: "f-distro_version" }, "Distro Version"), inputs.distro_version,
+    h("label", { for: "f-team" }, "Team"), inputs.team,
+    h("label", { for: "f-resources" }, "Resources"), inputs.resources,
+    h("label", { for: "f-environment" }, "Environment"), inputs.environment,
+    h("label", { for: "f-solution" }, "Solution"),
+    h("div", {},
+      inputs.solution,
+      locked ? h("p", { class: "muted" }, "The solution is encrypted and this server has no key for it; saving keeps it as it is.") : null,
+      solutionPreview,
+    ),
+    h("span"), confirmPanel,
+    h("span"), h("div", { class: "actions" },
+      h("button", { type: "submit" }, "Save Report"),
+      h("a", { class: "button secondary", href: id ? "#/reports/" + encodeURIComponent(id) : "#/" }, "Cancel"),
+    ),
+  );
+
+  app.replaceChildren(h("h1", {}, id ? "Edit Error Report" : "New Error Report"), form);
+  renderSolution();
+  updateConfirm();
+  inputs.symptom.focus();
+}
+
+signOut.addEventListener("click", () => {
+  setAPIToken("");
+  viewToken();
+});
+signOut.hidden = !apiToken();
+window.addEventListener("hashchange", route);
+route();
@@ -0,0 +1,171 @@
+// A small Markdown renderer for solutions: headings, paragraphs, lists,
+// block quotes, fenced and indented code, rules, and inline code, emphasis
+// and links. Everything is HTML-escaped first, so a solution can't inject
+// markup, and only http(s), mailto and relative links are kept.
+"use strict";
+
+const markdown = (() => {
+  function escapeHTML(text) {
+    return text
+      .replace(/&/g, "&amp;")
+      .replace(/</g, "&lt;")
+      .replace(/>/g, "&gt;")
+      .replace(/"/g, "&quot;")
+      .replace(/'/g, "&#39;");
+  }
+
+  // safeURL returns url escaped for an attribute, or "" for schemes such as
+  // javascript: that must not become links
+  function safeURL(url) {
+    const scheme = /^([a-z][a-z0-9+.-]*):/i.exec(url);
+    if (scheme && !/^(https?|mailto)$/i.test(scheme[1])) {
+      return "";
+    }
+    return escapeHTML(url);
+  }
+
+  function link(href, label) {
+    const url = safeURL(href);
+    if (!url) {
+      return label;
+    }
+    return `<a href="${url}" rel="noopener noreferrer" target="_blank">${label}</a>`;
+  }
+
+  // inline renders one line of text. Code spans are cut out first so that
+  // nothing inside them is treated as Markdown.
+  function inline(text) {
+    const parts = text.split(/(`+)([\s\S]*?[^`])\1(?!`)/);
+    let html = "";
+    for (let i = 0; i < parts.length; i++) {
+      if (i % 3 === 0) {
+        html += inlineText(parts[i]);
+      } else if (i % 3 === 2) {
+        html += `<code>${escapeHTML(parts[i].trim())}</code>`;
+      }
+    }
+    return html;
+  }
+
+  function inlineText(text) {
+    const links = [];
+    // Links are replaced by placeholders so emphasis doesn't break their URLs
+    const hold = (html) => {
+      links.push(html);
+      return `\u0000${links.length - 1}\u0000`;
+    };
+    text = text.replace(/\[([^\]]+)\]\(((?:[^()\s]|\([^()\s]*\))+)(?:\s+"[^"]*")?\)/g, (_, label, href) => hold(link(href, inlineText(label))));
+    text = text.replace(/<(https?:\/\/[^>\s]+)>/g, (_, url) => hold(link(url, escapeHTML(url))));
+    text = text.replace(/\bhttps?:\/\/[^\s<>"'\u0000]*[^\s<>"'\u0000.,;:!?)\]]/g, (url) => hold(link(url, escapeHTML(url))));
+
+    let html = escapeHTML(text);
+    html = html.replace(/\*\*(?=\S)([\s\S]*?\S)\*\*/g, "<strong>$1</strong>");
+    html = html.replace(/__(?=\S)([\s\S]*?\S)__/g, "<strong>$1</strong>");
+    html = html.replace(/(^|[^*\w])\*(?=\S)([^*]*?\S)\*(?!\w)/g, "$1<em>$2</em>");
+    html = html.replace(/(^|[^_\w])_(?=\S)([^_]*?\S)_(?!\w)/g, "$1<em>$2</em>");
+    html = html.replace(/~~(?=\S)([\s\S]*?\S)~~/g, "<del>$1</del>");
+    return html.replace(/\u0000(\d+)\u0000/g, (_, i) => links[Number(i)]);
+  }
+
+  const listItem = /^(\s*)([-*+]|\d+[.)])\s+(.*)$/;
+
+  function render(source) {
+    const lines = source.replace(/\r\n?/g, "\n").split("\n");
+    const out = [];
+    let paragraph = [];
+
+    const flush = () => {
+      if (paragraph.length > 0) {
+        out.push(`<p>${paragraph.map(inline).join("<br>\n")}</p>`);
+        paragraph = [];
+      }
+    };
+
+    for (let i = 0; i < lines.length; i++) {
+      const line = lines[i];
+
+      const fence = /^\s*(```+|~~~+)\s*([\w+-]*)/.exec(line);
+      if (fence) {
+        flush();
+        const code = [];
+        for (i++; i < lines.length && !lines[i].trim().startsWith(fence[1]); i++) {
+          code.push(lines[i]);
+        }
+        const lang = fence[2] ? ` class="language-${escapeHTML(fence[2])}"` : "";
+        out.push(`<pre><code${lang}>${escapeHTML(code.join("\n"))}</code></pre>`);
+        continue;
+      }
+
+      if (line.trim() === "") {
+        flush();
+        continue;
+      }
+
+      if (/^(?: {4}|\t)/.test(line) && paragraph.length === 0) {
+        const code = [];
+        for (; i < lines.length && (/^(?: {4}|\t)/.test(lines[i]) || lines[i].trim() === ""); i++) {
+          code.push(lines[i].replace(/^(?: {4}|\t)/, ""));
+        }
+        i--;
+        while (code.length > 0 && code[code.length - 1].trim() === "") {
+          code.pop();
+        }
+        out.push(`<pre><code>${escapeHTML(code.join("\n"))}</code></pre>`);
+        continue;
+      }
+
+      const heading = /^(#{1,6})\s+(.*?)\s*#*\s*$/.exec(line);
+      if (heading) {
+        flush();
+        // Solutions sit under the report's own headings, so start at h3
+        const level = Math.min(heading[1].length + 2, 6);
+        out.push(`<h${level}>${inline(heading[2])}</h${level}>`);
+        continue;
+      }
+
+      if (/^\s*([-*_])(\s*\1){2,}\s*$/.test(line)) {
+        flush();
+        out.push("<hr>");
+        continue;
+      }
+
+      if (/^\s*>/.test(line)) {
+        flush();
+        const quoted = [];
+        for (; i < lines.length && /^\s*>/.test(lines[i]); i++) {
+          quoted.push(lines[i].replace(/^\s*>\s?/, ""));
+        }
+        i--;
+        out.push(`<blockquote>${render(quoted.join("\n"))}</blockquote>`);
+        continue;
+      }
+
+      if (listItem.test(line)) {
+        flush();
+        const ordered = /^\s*\d/.test(line);
+        const items = [];
+        for (; i < lines.length; i++) {
+          const item = listItem.exec(lines[i]);
+          if (item && /^\d/.test(item[2]) === ordered) {
+            items.push(item[3]);
+          } else if (items.length > 0 && /^\s+\S/.test(lines[i])) {
+            // A continuation of the previous item
+            items[items.length - 1] += " " + lines[i].trim();
+          } else {
+            break;
+          }
+        }
+        i--;
+        const tag = ordered ? "ol" : "ul";
+        out.push(`<${tag}>${items.map((item) => `<li>${inline(item)}</li>`).join("")}</${tag}>`);
+        continue;
+      }
+
+      paragraph.push(line.trim());
+    }
+    flush();
+    return out.join("\n");
+  }
+
+  return { render, escapeHTML, safeURL };
+})();
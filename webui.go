@@ -0,0 +1,30 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// The web UI is plain HTML, CSS and JavaScript talking to /api/v1, embedded
+// so that goof serve needs nothing else and works offline
+//
+//go:embed web
+var webFiles embed.FS
+
+// webUIHandler serves the web UI. The content security policy only allows
+// the embedded files, so nothing is fetched from elsewhere and markup that
+// slipped into a rendered solution can't run scripts.
+func webUIHandler() http.Handler {
+	files, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.FileServerFS(files)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; img-src 'self' data:; frame-ancestors 'none'; base-uri 'none'; form-action 'self'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		fileServer.ServeHTTP(w, r)
+	})
+}